@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"data-splitter/internal/config"
 	"data-splitter/internal/database"
@@ -19,12 +20,19 @@ import (
 )
 
 var (
-	configPath = flag.String("config", "", "Path to configuration file (default: config.yaml)")
-	showInfo   = flag.Bool("info", false, "Show working directory and project directory information")
-	projectDir string // Set at build time with -ldflags
+	configPath      = flag.String("config", "", "Path to configuration file (default: config.yaml)")
+	showInfo        = flag.Bool("info", false, "Show working directory and project directory information")
+	allowOpenPeriod = flag.Bool("allow-open-period", false, "Archive periods that have not closed yet (end + archive.options.grace_period still ahead)")
+	projectDir      string // Set at build time with -ldflags
 )
 
 func main() {
+	// Subcommands take their own flags
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		runRestore(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
 
 	// Handle --info flag
@@ -44,7 +52,20 @@ func main() {
 	// Setup logging with config
 	setupLogging(cfg)
 
-	logrus.Infof("Configuration loaded: %d tables, %d years to process", len(cfg.Tables), len(cfg.Archive.Years))
+	if *allowOpenPeriod {
+		cfg.Archive.Options.AllowOpenPeriod = true
+		logrus.Warn("==================================================================")
+		logrus.Warn("--allow-open-period is set: periods that have not closed will be")
+		logrus.Warn("archived (and deleted if delete_after_archive) while they may still")
+		logrus.Warn("receive rows")
+		logrus.Warn("==================================================================")
+	}
+
+	if cfg.Archive.Years.Auto {
+		logrus.Infof("Configuration loaded: %d tables, years discovered per table", len(cfg.Tables))
+	} else {
+		logrus.Infof("Configuration loaded: %d tables, %d years to process", len(cfg.Tables), len(cfg.Archive.Years.List))
+	}
 
 	// Connect to source database
 	sourceDB, err := database.ConnectSourceDB(&cfg.Database)
@@ -61,53 +82,295 @@ func main() {
 		}
 	}
 
-	logrus.Infof("Starting processing of %d enabled tables", totalTables)
-
-	processedTables := 0
-	for _, table := range cfg.Tables {
+	// Check every split_column against its split_type before archiving anything
+	var enabled []int
+	var families [][]string
+	for i, table := range cfg.Tables {
 		if !table.Enabled {
 			logrus.Debugf("Skipping disabled table: %s", table.Name)
 			continue
 		}
+		if err := database.ResolveSplitVia(sourceDB, &table); err != nil {
+			logrus.Fatalf("Invalid split_via for table %s: %v", table.Name, err)
+		}
+		if err := database.CheckSplitColumn(sourceDB, &table); err != nil {
+			logrus.Fatalf("Invalid split_column for table %s: %v", table.Name, err)
+		}
+		if err := database.CheckRowCondition(sourceDB, &table); err != nil {
+			logrus.Fatalf("Invalid where for table %s: %v", table.Name, err)
+		}
+		family, err := database.CascadeTables(sourceDB, &table)
+		if err != nil {
+			logrus.Fatalf("Invalid children for table %s: %v", table.Name, err)
+		}
 
-		processedTables++
-		logrus.Infof("Processing table %d/%d: %s", processedTables, totalTables, table.Name)
+		// The table itself comes first: it names the table in cycle reports
+		names := []string{table.Name}
+		for _, member := range family[:len(family)-1] {
+			names = append(names, member.Name)
+		}
+		enabled = append(enabled, i)
+		families = append(families, names)
+	}
 
-		// Process each year for this table
-		totalYears := len(cfg.Archive.Years)
-		for yearIndex, year := range cfg.Archive.Years {
-			logrus.Infof("Processing year %d/%d: %d for table %s", yearIndex+1, totalYears, year, table.Name)
+	if err := database.CheckFamilies(families); err != nil {
+		logrus.Fatalf("Invalid children: %v", err)
+	}
 
-			// Ensure heartbeat interval from processing config is available to archive options
-			if cfg.Archive.Options.HeartbeatBatchInterval == 0 {
-				cfg.Archive.Options.HeartbeatBatchInterval = cfg.Processing.HeartbeatBatchInterval
+	// A resume position belongs to one table (or child) of the run
+	resume := cfg.Archive.Options.Resume
+	resumeOwner := -1
+	if resume != nil {
+		for k, names := range families {
+			for _, name := range names {
+				if name == resume.Table {
+					resumeOwner = enabled[k]
+				}
 			}
+		}
+		if resumeOwner < 0 {
+			logrus.Fatalf("archive.options.resume names table %s, which is not archived in this run", resume.Table)
+		}
+	}
 
-			if err := processTableYear(sourceDB, &cfg.Database, &table, year, &cfg.Archive.Options); err != nil {
-				// If the error (possibly wrapped) contains a FatalMigrationError,
-				// print to stderr and exit non-zero so the pipeline step fails.
-				var fmErr database.FatalMigrationError
-				if errors.As(err, &fmErr) {
-					fmt.Fprintf(os.Stderr, "FATAL: %v\n", fmErr.Error())
-					os.Exit(1)
+	// Order the tables by their foreign keys: parents are copied first and,
+	// once every table is copied, children are deleted first
+	keys, err := database.ForeignKeys(sourceDB)
+	if err != nil {
+		logrus.Fatalf("Failed to read foreign keys: %v", err)
+	}
+	// split_via tables depend on their parent even without a declared key:
+	// their rows are deleted through the parent rows
+	for _, index := range enabled {
+		if via := cfg.Tables[index].SplitVia; via != nil {
+			keys = append(keys, database.ForeignKey{Table: cfg.Tables[index].Name, Columns: []string{via.Key}, RefTable: via.Table})
+		}
+	}
+	// The tables of a group are ordered as one unit, then among themselves
+	units, groupNames := tableUnits(cfg, enabled)
+	unitFamilies := make([][]string, len(units))
+	for u, members := range units {
+		for _, member := range members {
+			unitFamilies[u] = append(unitFamilies[u], families[member]...)
+		}
+	}
+	order, err := database.DependencyOrder(keys, unitFamilies)
+	if err != nil {
+		logrus.Fatalf("Cannot order tables: %v (disable one of the tables or archive it as a child)", err)
+	}
+	var schedule [][]int
+	var orderNames []string
+	for _, u := range order {
+		members := units[u]
+		memberFamilies := make([][]string, len(members))
+		for k, member := range members {
+			memberFamilies[k] = families[member]
+		}
+		inner, err := database.DependencyOrder(keys, memberFamilies)
+		if err != nil {
+			logrus.Fatalf("Cannot order tables of group %s: %v", groupNames[u], err)
+		}
+		ordered := make([]int, len(inner))
+		for k, i := range inner {
+			ordered[k] = enabled[members[i]]
+			orderNames = append(orderNames, cfg.Tables[ordered[k]].Name)
+		}
+		schedule = append(schedule, ordered)
+	}
+	logrus.Infof("Table order (parents first): %s", strings.Join(orderNames, ", "))
+
+	// Cutoffs are reported in the business time zone
+	loc, err := database.LoadTimeZone(cfg.Database.TimeZone)
+	if err != nil {
+		logrus.Fatalf("Invalid database.time_zone: %v", err)
+	}
+
+	logrus.Infof("Starting processing of %d enabled tables", totalTables)
+
+	var deletes []pendingDelete
+	processedTables := 0
+	for _, unit := range schedule {
+		// Every table of a group uses the cutoff taken when the group starts
+		// and reads the source through one snapshot
+		cutoff := time.Now().Truncate(time.Second)
+		group := cfg.Tables[unit[0]].Group
+		readDB := sourceDB
+		var snapshot *gorm.DB
+		var groupTables []string
+
+		// finishGroup ends the snapshot (rolled back unless the group
+		// completed) and reports the group; it runs once on every exit path,
+		// including right before a fatal error stops the run
+		finished := false
+		finishGroup := func(status string) {
+			if group == "" || finished {
+				return
+			}
+			finished = true
+			if snapshot != nil {
+				if status == "completed" {
+					snapshot.Commit()
+				} else {
+					snapshot.Rollback()
 				}
-				if cfg.Processing.ContinueOnError {
-					logrus.Errorf("Failed to process table %s year %d: %v", table.Name, year, err)
+			}
+			logrus.Infof("Completed group %s with cutoff %s: %s", group, cutoff.In(loc).Format(time.RFC3339), status)
+			fmt.Printf("GROUP name=%s cutoff=%s tables=%s status=%s\n", group, cutoff.In(loc).Format(time.RFC3339), strings.Join(groupTables, ","), status)
+		}
+		fatalf := func(format string, args ...interface{}) {
+			finishGroup("failed")
+			logrus.Fatalf(format, args...)
+		}
+
+		if group != "" {
+			for _, index := range unit {
+				groupTables = append(groupTables, cfg.Tables[index].Name)
+			}
+			if snapshot, err = database.BeginSnapshot(sourceDB, groupTables[0]); err != nil {
+				fatalf("Failed to start group %s: %v", group, err)
+			}
+			if snapshot != nil {
+				readDB = snapshot
+			}
+			logrus.Infof("Processing group %s (%s) with cutoff %s (snapshot: %t)", group, strings.Join(groupTables, ", "), cutoff.In(loc).Format(time.RFC3339), snapshot != nil)
+			fmt.Printf("PLAN group=%s cutoff=%s snapshot=%t tables=%s\n", group, cutoff.In(loc).Format(time.RFC3339), snapshot != nil, strings.Join(groupTables, ","))
+		}
+
+		// A group stops at its first error: the remaining tables would read
+		// through a snapshot that may be aborted, and a partly archived group
+		// deletes nothing
+		var unitDeletes []pendingDelete
+		var groupErr error
+		failed := false
+	tables:
+		for _, index := range unit {
+			table := cfg.Tables[index]
+			processedTables++
+			logrus.Infof("Processing table %d/%d: %s", processedTables, totalTables, table.Name)
+
+			// Process each period (year, quarter, month or day) for this table;
+			// the periods were validated when the config was loaded
+			periods, err := tablePeriods(readDB, &table, &cfg.Archive.Years, cutoff)
+			if err != nil {
+				fatalf("Failed to resolve periods for table %s: %v", table.Name, err)
+			}
+			if index == resumeOwner && !hasPeriod(periods, resume.Period) {
+				fatalf("archive.options.resume names period %s, which is not among the periods of table %s in this run", resume.Period, table.Name)
+			}
+			for periodIndex, period := range periods {
+				logrus.Infof("Processing period %d/%d: %s for table %s", periodIndex+1, len(periods), period, table.Name)
+
+				// Ensure heartbeat interval from processing config is available to archive options
+				if cfg.Archive.Options.HeartbeatBatchInterval == 0 {
+					cfg.Archive.Options.HeartbeatBatchInterval = cfg.Processing.HeartbeatBatchInterval
+				}
+
+				pending, err := processTablePeriod(readDB, &cfg.Database, &table, period, cutoff, &cfg.Archive.Options)
+				if err != nil {
+					failed = true
+					err = fmt.Errorf("failed to process table %s period %s: %w", table.Name, period, err)
+					if group != "" {
+						groupErr = err
+						break tables
+					}
+					handleProcessError(cfg, err)
 					continue
-				} else {
-					logrus.Fatalf("Failed to process table %s year %d: %v", table.Name, year, err)
 				}
+				if pending != nil {
+					unitDeletes = append(unitDeletes, *pending)
+				}
+
+				logrus.Infof("Completed period %s for table %s", period, table.Name)
 			}
 
-			logrus.Infof("Completed year %d for table %s", year, table.Name)
+			logrus.Infof("Completed table %s (%d/%d)", table.Name, processedTables, totalTables)
 		}
 
-		logrus.Infof("Completed table %s (%d/%d)", table.Name, processedTables, totalTables)
+		if groupErr != nil {
+			finishGroup("failed")
+			handleProcessError(cfg, fmt.Errorf("group %s stopped, nothing of it will be deleted: %w", group, groupErr))
+			continue
+		}
+		if failed {
+			finishGroup("failed")
+		} else {
+			finishGroup("completed")
+		}
+		deletes = append(deletes, unitDeletes...)
+	}
+
+	// Delete in reverse order: children before the parents they reference
+	for i := len(deletes) - 1; i >= 0; i-- {
+		pending := deletes[i]
+		table := pending.family[len(pending.family)-1]
+		if err := deleteTablePeriod(sourceDB, pending, &cfg.Archive.Options); err != nil {
+			handleProcessError(cfg, fmt.Errorf("failed to delete table %s period %s: %w", table.Name, pending.period, err))
+		}
 	}
 
 	logrus.Info("Data Splitter completed successfully")
 }
 
+// pendingDelete is a copied and validated table/period whose source rows
+// are deleted after every table is copied
+type pendingDelete struct {
+	family []*types.Table // children first, the table last
+	period database.Period
+	counts []int64 // source rows of each table when validated
+}
+
+// hasPeriod reports whether label names one of the periods
+func hasPeriod(periods []database.Period, label string) bool {
+	for _, period := range periods {
+		if period.String() == label {
+			return true
+		}
+	}
+	return false
+}
+
+// tableUnits splits the enabled tables (indexes into cfg.Tables) into the
+// units processed together: one per group, in the order of its first table,
+// and one per table without a group. It returns indexes into enabled and
+// the group name of every unit ("" for single tables).
+func tableUnits(cfg *types.Config, enabled []int) ([][]int, []string) {
+	var units [][]int
+	var names []string
+	unitOf := make(map[string]int)
+	for i, index := range enabled {
+		group := cfg.Tables[index].Group
+		if group == "" {
+			units = append(units, []int{i})
+			names = append(names, "")
+			continue
+		}
+		if u, ok := unitOf[group]; ok {
+			units[u] = append(units[u], i)
+			continue
+		}
+		unitOf[group] = len(units)
+		units = append(units, []int{i})
+		names = append(names, group)
+	}
+	return units, names
+}
+
+// handleProcessError stops the run on err unless processing.continue_on_error
+// is set. A FatalMigrationError always exits non-zero so the pipeline step
+// fails.
+func handleProcessError(cfg *types.Config, err error) {
+	var fmErr database.FatalMigrationError
+	if errors.As(err, &fmErr) {
+		fmt.Fprintf(os.Stderr, "FATAL: %v\n", fmErr.Error())
+		os.Exit(1)
+	}
+	if cfg.Processing.ContinueOnError {
+		logrus.Errorf("%v", err)
+		return
+	}
+	logrus.Fatalf("%v", err)
+}
+
 func displayInfo() {
 	workingDir, err := os.Getwd()
 	if err != nil {
@@ -145,7 +408,7 @@ func displayInfo() {
 	fmt.Println("📦 Installation Locations:")
 	fmt.Println("  Linux/macOS: /usr/local/bin/data-splitter")
 	fmt.Println("  Windows:     C:\\Program Files\\data-splitter\\data-splitter.exe")
-	fmt.Println("               or %USERPROFILE%\\bin\\data-splitter.exe")
+	fmt.Printf("               or %%USERPROFILE%%\\bin\\data-splitter.exe\n")
 	fmt.Println()
 	fmt.Println("📁 Configuration & Logs:")
 	fmt.Println("  Config file: config.yaml (in working directory)")
@@ -224,68 +487,301 @@ func setupLogging(config *types.Config) {
 	logrus.Infof("Logging to file: %s", logPath)
 }
 
-func processTableYear(sourceDB *gorm.DB, dbConfig *types.Database, table *types.Table, year int, options *types.ArchiveOptions) error {
-	logrus.Infof("Processing table %s for year %d", table.Name, year)
+// tablePeriods returns the periods to process for a table. Retention
+// policies and years: auto are resolved against now (the group cutoff for
+// grouped tables) and the source data here. The computed boundaries of every period (in
+// database.time_zone) are logged and printed as PLAN lines so scheduled runs
+// can be audited.
+func tablePeriods(sourceDB *gorm.DB, table *types.Table, years *types.Years, now time.Time) ([]database.Period, error) {
+	var periods []database.Period
+	if table.Retention == nil {
+		yearList := years.List
+		if years.Auto && len(table.Periods) == 0 {
+			discovered, err := database.DiscoverYears(sourceDB, table, years, now)
+			if err != nil {
+				return nil, err
+			}
+			logrus.Infof("Discovered years for table %s: %s", table.Name, discovered.Summary())
+			fmt.Printf("PLAN table=%s %s\n", table.Name, discovered.Summary())
+			yearList = discovered.Years
+		}
+
+		var err error
+		if periods, err = database.TablePeriods(table, yearList); err != nil {
+			return nil, err
+		}
+	} else {
+		plan, err := database.ResolveRetention(sourceDB, table, now)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Infof("Retention plan for table %s: %s", table.Name, plan.Summary())
+		fmt.Printf("PLAN table=%s %s\n", table.Name, plan.Summary())
+		periods = plan.Periods
+	}
+
+	for _, period := range periods {
+		bounds, err := database.PeriodBounds(table, period)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Infof("Period %s of table %s: %s", period, table.Name, bounds)
+		fmt.Printf("PLAN table=%s %s %s\n", table.Name, database.PeriodKeys(period), bounds)
+	}
+	return periods, nil
+}
+
+// processTablePeriod copies and validates a table (and its children) for a
+// period. cutoff is the instant the run (or group) treats as now; periods of
+// grouped tables end there. It returns the tables whose rows may now be
+// deleted, or nil when nothing was copied (dry run, scripts).
+func processTablePeriod(sourceDB *gorm.DB, source *types.Database, table *types.Table, period database.Period, cutoff time.Time, options *types.ArchiveOptions) (*pendingDelete, error) {
+	logrus.Infof("Processing table %s for period %s", table.Name, period)
+	if table.Where != "" {
+		logrus.Infof("Only rows of table %s matching where: %s", table.Name, table.Where)
+	}
+
+	// Refuse periods that may still receive rows
+	if err := database.CheckPeriodClosed(table, period, options.GracePeriod, cutoff); err != nil {
+		switch {
+		case options.AllowOpenPeriod:
+			logrus.Warnf("ARCHIVING OPEN PERIOD (--allow-open-period): %v", err)
+		case options.DryRun:
+			logrus.Warnf("[DRY RUN] %v; a real run would refuse it without --allow-open-period", err)
+		default:
+			return nil, fmt.Errorf("refusing to archive: %w (wait for grace_period to pass or use --allow-open-period)", err)
+		}
+	}
+
+	// Periods stop at the cutoff, so rows written to an open period while it
+	// is copied are neither copied nor deleted; in a group every table
+	// selects (and deletes) the same rows
+	clamped, err := database.ClampPeriod(table, period, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	if clamped.End != period.End {
+		bounds, err := database.PeriodBounds(table, clamped)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Infof("Period %s of table %s ends at the cutoff: %s", period, table.Name, bounds)
+	}
+	period = clamped
+
+	// Children are copied before the table and deleted before it, so their
+	// rows are selected while the parent rows still exist
+	family, err := database.CascadeTables(sourceDB, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range family[:len(family)-1] {
+		link := member.Parent
+		logrus.Infof("Archiving child table %s with %s (%s.%s -> %s.%s)", member.Name, table.Name, member.Name, link.Key, link.Parent.Name, link.ParentKey)
+	}
+
+	if table.Export != nil {
+		if options.ScriptDir != "" {
+			return nil, fmt.Errorf("script_dir is not supported for export tables")
+		}
+		var exported []*types.Table
+		for _, member := range family {
+			sealed, err := processTablePeriodExport(sourceDB, member, period, options)
+			if err != nil {
+				return nil, err
+			}
+			if sealed {
+				exported = append(exported, member)
+			}
+		}
+		if len(exported) == 0 {
+			return nil, nil
+		}
+		return newPendingDelete(sourceDB, exported, period)
+	}
+
+	// Report cross-engine type conversions before anything is written so
+	// lossy mappings can be reviewed with a dry run
+	for _, member := range family {
+		mapping, err := database.PlanTypeMapping(sourceDB, member, period)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan type mapping: %w", err)
+		}
+		if mapping == nil {
+			continue
+		}
+		reportDir := options.MappingReportDir
+		if reportDir == "" {
+			reportDir = "logs"
+		}
+		reportPath, err := mapping.WriteReport(reportDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write type mapping report: %w", err)
+		}
+		logrus.Infof("Type mapping %s -> %s for table %s written to %s", mapping.Source, mapping.Target, member.Name, reportPath)
+		for _, col := range mapping.LossyColumns() {
+			logrus.Warnf("Lossy conversion for %s.%s: %s -> %s (%s)", member.Name, col.Column, col.SourceType, col.Target.Name, col.Target.Note)
+		}
+	}
+
+	// In review mode the statements are written to files for a DBA instead
+	// of being executed
+	if options.ScriptDir != "" {
+		for _, member := range family {
+			scripts, err := database.WriteArchiveScripts(sourceDB, source, member, period, options.ScriptDir, options)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write archive scripts: %w", err)
+			}
+			logrus.Infof("Wrote %d SQL scripts for table %s period %s to %s", len(scripts.Files), member.Name, period, scripts.Dir)
+		}
+		return nil, nil
+	}
 
 	// Check if dry run
 	if options.DryRun {
-		logrus.Infof("[DRY RUN] Would process table %s year %d", table.Name, year)
-		return nil
+		for _, member := range family {
+			logrus.Infof("[DRY RUN] Would process table %s period %s", member.Name, period)
+		}
+		return nil, nil
 	}
 
-	// Connect to archive database
-	archiveDB, err := database.ConnectArchiveDB(dbConfig, table, year)
+	// Connect to archive database (table.ArchiveDatabase holds the resolved
+	// archive server settings, which default to the source server)
+	archiveDB, err := database.ConnectArchiveDB(table.ArchiveDatabase, table, period)
 	if err != nil {
 		// If archive database doesn't exist and we should create it
 		if options.CreateArchiveDB {
 			logrus.Infof("Archive database doesn't exist, creating it")
-			archiveDBName := database.BuildArchiveDBName(table.ArchivePattern, year)
+			archiveDBName := database.BuildArchiveDBName(table.ArchivePattern, table.Name, period)
 
-			if err := database.CreateArchiveDatabase(sourceDB, archiveDBName); err != nil {
-				return fmt.Errorf("failed to create archive database: %w", err)
+			if err := database.CreateArchiveDatabase(table.ArchiveDatabase, archiveDBName); err != nil {
+				return nil, fmt.Errorf("failed to create archive database: %w", err)
 			}
 
 			// Try connecting again
-			archiveDB, err = database.ConnectArchiveDB(dbConfig, table, year)
+			archiveDB, err = database.ConnectArchiveDB(table.ArchiveDatabase, table, period)
 			if err != nil {
-				return fmt.Errorf("failed to connect to newly created archive database: %w", err)
+				return nil, fmt.Errorf("failed to connect to newly created archive database: %w", err)
 			}
 		} else {
-			return fmt.Errorf("failed to connect to archive database: %w", err)
+			return nil, fmt.Errorf("failed to connect to archive database: %w", err)
 		}
 	}
 	defer database.CloseConnection(archiveDB)
 
-	// Get table schema from source
-	schema, err := database.GetTableSchema(sourceDB, table.Name)
-	if err != nil {
-		return fmt.Errorf("failed to get table schema: %w", err)
-	}
+	// Create the archive tables parents first so foreign keys in the
+	// copied schemas can be resolved
+	for i := len(family) - 1; i >= 0; i-- {
+		// Get table schema from source (rendered from the type mapping when the
+		// archive uses a different engine)
+		schema, err := database.GetArchiveTableSchema(sourceDB, archiveDB, family[i].Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get table schema: %w", err)
+		}
 
-	// Create table in archive database
-	if err := database.CreateArchiveTable(archiveDB, schema, table.Name); err != nil {
-		return fmt.Errorf("failed to create archive table: %w", err)
+		// Create table in archive database
+		if err := database.CreateArchiveTable(archiveDB, schema, family[i].Name); err != nil {
+			return nil, fmt.Errorf("failed to create archive table: %w", err)
+		}
 	}
 
-	// Migrate data
-	if err := database.MigrateTableData(sourceDB, archiveDB, table, year, options); err != nil {
-		return fmt.Errorf("failed to migrate data: %w", err)
+	for _, member := range family {
+		// Migrate data
+		if err := database.MigrateTableData(sourceDB, archiveDB, member, period, options); err != nil {
+			return nil, fmt.Errorf("failed to migrate data: %w", err)
+		}
 	}
 
-	// Validate migration
-	if err := database.ValidateMigration(sourceDB, archiveDB, table, year); err != nil {
-		return fmt.Errorf("migration validation failed: %w", err)
+	// Validate migration once every table is copied (the archive counts of
+	// children join to the archived parent rows)
+	for _, member := range family {
+		if err := database.ValidateMigration(sourceDB, archiveDB, member, period); err != nil {
+			return nil, fmt.Errorf("migration validation failed: %w", err)
+		}
 	}
 
-	// Delete migrated data if configured
-	if err := database.DeleteMigratedData(sourceDB, table, year, options); err != nil {
-		return fmt.Errorf("failed to delete migrated data: %w", err)
+	logrus.Infof("Successfully copied table %s for period %s", table.Name, period)
+	return newPendingDelete(sourceDB, family, period)
+}
+
+// newPendingDelete records the source row counts of validated tables, which
+// are checked again right before their rows are deleted
+func newPendingDelete(sourceDB *gorm.DB, family []*types.Table, period database.Period) (*pendingDelete, error) {
+	counts := make([]int64, len(family))
+	for i, member := range family {
+		count, err := database.GetRowCount(sourceDB, member, period)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count source rows: %w", err)
+		}
+		counts[i] = count
 	}
+	return &pendingDelete{family: family, period: period, counts: counts}, nil
+}
 
-	logrus.Infof("Successfully processed table %s for year %d", table.Name, year)
+// deleteTablePeriod deletes the archived rows of a table and its children,
+// children first. Nothing is deleted when the source rows of any of them
+// changed since they were validated: the new rows were not copied.
+func deleteTablePeriod(sourceDB *gorm.DB, pending pendingDelete, options *types.ArchiveOptions) error {
+	family, period := pending.family, pending.period
+	if options.DeleteAfterArchive {
+		for i, member := range family {
+			count, err := database.GetRowCount(sourceDB, member, period)
+			if err != nil {
+				return fmt.Errorf("failed to recount source rows: %w", err)
+			}
+			if count != pending.counts[i] {
+				return fmt.Errorf("source rows of table %s period %s changed since they were copied (%d validated, %d now); nothing was deleted, run the period again", member.Name, period, pending.counts[i], count)
+			}
+		}
+	}
+	for _, member := range family {
+		if err := database.DeleteMigratedData(sourceDB, member, period, options); err != nil {
+			return fmt.Errorf("failed to delete migrated data: %w", err)
+		}
+	}
 	return nil
 }
 
+// processTablePeriodExport archives a table/period to export files instead of
+// an archive database and reports whether an export was sealed. Exported rows
+// are deleted by the caller (only allowed once sealed and, with an upload
+// configured, verified in the bucket).
+func processTablePeriodExport(sourceDB *gorm.DB, table *types.Table, period database.Period, options *types.ArchiveOptions) (bool, error) {
+	exportDir := database.ExportDir(table, period)
+
+	if options.DryRun {
+		logrus.Infof("[DRY RUN] Would export table %s period %s as %s (%s) to %s", table.Name, period, table.Export.Format, table.Export.Compression, exportDir)
+		if upload := table.Export.Upload; upload != nil {
+			logrus.Infof("[DRY RUN] Would upload to %s/%s as %s", upload.Endpoint, upload.Bucket, database.BuildObjectKey(table, period, "{file}"))
+		}
+		return false, nil
+	}
+
+	manifest, err := database.ExportTableData(sourceDB, table, period, options)
+	if err != nil {
+		return false, fmt.Errorf("failed to export data: %w", err)
+	}
+	if manifest == nil {
+		logrus.Infof("No rows to export for table %s period %s", table.Name, period)
+		return false, nil
+	}
+
+	// Validate the sealed export against the source
+	if err := database.ValidateMigration(sourceDB, nil, table, period); err != nil {
+		return false, fmt.Errorf("export validation failed: %w", err)
+	}
+
+	// Upload to object storage and verify checksums against the manifest
+	if table.Export.Upload != nil {
+		if err := database.UploadExport(table, period); err != nil {
+			return false, fmt.Errorf("failed to upload export: %w", err)
+		}
+	}
+
+	logrus.Infof("Successfully exported table %s for period %s to %s", table.Name, period, exportDir)
+	return true, nil
+}
+
 // buildCrossPlatform builds binaries for all supported platforms
 func buildCrossPlatform() error {
 	platforms := []struct {
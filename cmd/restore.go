@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"data-splitter/internal/config"
+	"data-splitter/internal/database"
+	"data-splitter/pkg/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runRestore implements `data-splitter restore`: archived rows of one
+// table/period are upserted back into the source table
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreConfig := fs.String("config", "", "Path to configuration file (default: config.yaml)")
+	tableName := fs.String("table", "", "Table to restore (required)")
+	year := fs.Int("year", 0, "Archive year to restore from (yearly tables; fiscal year label for tables with a fiscal_year_start)")
+	periodLabel := fs.String("period", "", "Archive period to restore from, e.g. 2024-Q1, 2024-01 or 2024-01-15 (tables with a finer granularity)")
+	from := fs.String("from", "", "Only restore rows with split_column >= this date (YYYY-MM-DD or YYYY-MM-DD HH:MM:SS)")
+	to := fs.String("to", "", "Only restore rows with split_column < this date (YYYY-MM-DD or YYYY-MM-DD HH:MM:SS)")
+	ids := fs.String("ids", "", "Only restore these primary key values (comma separated)")
+	dryRun := fs.Bool("dry-run", false, "Only report how many rows would be restored")
+	disableConstraints := fs.Bool("disable-constraints", false, "Disable foreign key/check constraints (and PostgreSQL triggers) while restoring")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: data-splitter restore --table <name> (--year <year> | --period <period>) [options]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *tableName == "" || (*year == 0) == (*periodLabel == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	filter, err := parseRestoreFilter(*from, *to, *ids)
+	if err != nil {
+		logrus.Fatalf("Invalid restore filter: %v", err)
+	}
+
+	cfg, err := config.LoadConfig(*restoreConfig)
+	if err != nil {
+		logrus.Fatalf("Failed to load configuration: %v", err)
+	}
+	setupLogging(cfg)
+
+	var table *types.Table
+	for i := range cfg.Tables {
+		if cfg.Tables[i].Name == *tableName {
+			table = &cfg.Tables[i]
+			break
+		}
+	}
+	if table == nil {
+		logrus.Fatalf("Table %s is not configured", *tableName)
+	}
+	if table.Export != nil {
+		logrus.Fatalf("Table %s is archived to %s files; restore only supports archive databases", table.Name, table.Export.Format)
+	}
+
+	if *periodLabel == "" {
+		*periodLabel = fmt.Sprintf("%d", *year)
+	}
+	periods, err := database.ParsePeriods(table.Granularity, table.FiscalYearStart, *periodLabel)
+	if err != nil {
+		logrus.Fatalf("Invalid period: %v", err)
+	}
+	if len(periods) != 1 {
+		logrus.Fatalf("Table %s is split by %s: pass a single %s with --period (e.g. %s)", table.Name, periods[0].Granularity, periods[0].Granularity, periods[0])
+	}
+	period := periods[0]
+
+	options := cfg.Archive.Options
+	if options.HeartbeatBatchInterval == 0 {
+		options.HeartbeatBatchInterval = cfg.Processing.HeartbeatBatchInterval
+	}
+	options.Resume = nil
+
+	logrus.Infof("Restoring table %s from archive %s", table.Name, database.BuildArchiveDBName(table.ArchivePattern, table.Name, period))
+	if bounds, err := database.PeriodBounds(table, period); err == nil {
+		logrus.Infof("Period %s of table %s: %s", period, table.Name, bounds)
+	}
+
+	sourceDB, err := database.ConnectSourceDB(&cfg.Database)
+	if err != nil {
+		logrus.Fatalf("Failed to connect to source database: %v", err)
+	}
+	defer database.CloseConnection(sourceDB)
+	if err := database.ResolveSplitVia(sourceDB, table); err != nil {
+		logrus.Fatalf("Invalid split_via for table %s: %v", table.Name, err)
+	}
+	if err := database.CheckSplitColumn(sourceDB, table); err != nil {
+		logrus.Fatalf("Invalid split_column for table %s: %v", table.Name, err)
+	}
+	if err := database.CheckRowCondition(sourceDB, table); err != nil {
+		logrus.Fatalf("Invalid where for table %s: %v", table.Name, err)
+	}
+
+	archiveDB, err := database.ConnectArchiveDB(table.ArchiveDatabase, table, period)
+	if err != nil {
+		logrus.Fatalf("Failed to connect to archive database: %v", err)
+	}
+	defer database.CloseConnection(archiveDB)
+
+	count, err := database.CountRestorableRows(archiveDB, table, period, filter)
+	if err != nil {
+		logrus.Fatalf("Failed to count archived rows: %v", err)
+	}
+
+	if *dryRun || options.DryRun {
+		logrus.Infof("[DRY RUN] Would restore %d rows into table %s from period %s", count, table.Name, period)
+		fmt.Printf("FINAL table=%s %s restorable=%d dry_run=true exit=0\n", table.Name, database.PeriodKeys(period), count)
+		return
+	}
+
+	restored, err := database.RestoreTableData(sourceDB, archiveDB, table, period, filter, *disableConstraints, &options)
+	if err != nil {
+		logrus.Fatalf("Failed to restore table %s period %s: %v", table.Name, period, err)
+	}
+
+	if err := database.ValidateRestore(sourceDB, archiveDB, table, period, filter); err != nil {
+		logrus.Fatalf("Restore validation failed: %v", err)
+	}
+
+	logrus.Infof("Restored %d rows into table %s from period %s", restored, table.Name, period)
+}
+
+// parseRestoreFilter builds the restore filter from the command line flags
+func parseRestoreFilter(from, to, ids string) (*database.RestoreFilter, error) {
+	filter := &database.RestoreFilter{}
+
+	var err error
+	if from != "" {
+		if filter.From, err = parseRestoreTime(from); err != nil {
+			return nil, fmt.Errorf("--from: %w", err)
+		}
+	}
+	if to != "" {
+		if filter.To, err = parseRestoreTime(to); err != nil {
+			return nil, fmt.Errorf("--to: %w", err)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("--from must be before --to")
+	}
+
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			filter.PrimaryKeys = append(filter.PrimaryKeys, id)
+		}
+	}
+
+	return filter, nil
+}
+
+// parseRestoreTime accepts a date or a date with time
+func parseRestoreTime(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q (expected YYYY-MM-DD or YYYY-MM-DD HH:MM:SS)", value)
+}
@@ -3,7 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"data-splitter/internal/database"
 	"data-splitter/pkg/types"
 
 	"github.com/joho/godotenv"
@@ -54,6 +56,15 @@ func LoadConfig(configPath string) (*types.Config, error) {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
+	resolveArchiveDatabases(&config)
+	resolveExports(&config)
+	for i := range config.Tables {
+		config.Tables[i].TimeZone = config.Database.TimeZone
+	}
+	if err := resolveSplitVia(&config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
 	return &config, nil
 }
 
@@ -63,6 +74,14 @@ func validateConfig(config *types.Config) error {
 		return fmt.Errorf("database.type is required")
 	}
 
+	dialect, err := database.LookupDialect(config.Database.Type)
+	if err != nil {
+		return fmt.Errorf("database.type: %w", err)
+	}
+	if dialect.Name() == "sqlite" {
+		return fmt.Errorf("database.type: sqlite is only supported as an archive target (archive_pattern ending in .sqlite)")
+	}
+
 	if config.Database.Host == "" {
 		return fmt.Errorf("database.host is required")
 	}
@@ -75,8 +94,53 @@ func validateConfig(config *types.Config) error {
 		return fmt.Errorf("at least one table must be configured")
 	}
 
-	if len(config.Archive.Years) == 0 {
-		return fmt.Errorf("at least one year must be specified in archive.years")
+	if config.Archive.FiscalYearStart < 0 || config.Archive.FiscalYearStart > 12 {
+		return fmt.Errorf("archive.fiscal_year_start must be a month between 1 and 12 (got %d)", config.Archive.FiscalYearStart)
+	}
+
+	if err := validateYears(&config.Archive.Years); err != nil {
+		return err
+	}
+
+	// archive.years may be omitted when every enabled table lists its own periods
+	if len(config.Archive.Years.List) == 0 && !config.Archive.Years.Auto {
+		for i, table := range config.Tables {
+			if table.Enabled && len(table.Periods) == 0 && table.Retention == nil {
+				return fmt.Errorf("at least one year must be specified in archive.years, or years: auto (or table[%d].periods / retention)", i)
+			}
+		}
+	}
+
+	// The batch loop stops at the first short batch; a batch of 0 rows never is
+	if config.Archive.Options.BatchSize <= 0 {
+		return fmt.Errorf("archive.options.batch_size must be a positive number of rows (got %d)", config.Archive.Options.BatchSize)
+	}
+
+	if err := database.ValidateGracePeriod(config.Archive.Options.GracePeriod); err != nil {
+		return fmt.Errorf("archive.options.grace_period: %w", err)
+	}
+
+	if config.Archive.Options.ResumeOffset > 0 {
+		return fmt.Errorf("archive.options.resume_offset is no longer supported: batches are paged by primary key; use archive.options.resume: {table, period, key} with the last migrated key")
+	}
+	if len(config.Archive.Options.ResumeKey) > 0 {
+		return fmt.Errorf("archive.options.resume_key is no longer supported: it applied to every table and period; use archive.options.resume: {table, period, key}")
+	}
+	if err := validateResume(config); err != nil {
+		return fmt.Errorf("archive.options.resume: %w", err)
+	}
+
+	if err := validateTLS("database.tls", config.Database.TLS); err != nil {
+		return err
+	}
+	if _, err := database.LoadTimeZone(config.Database.TimeZone); err != nil {
+		return fmt.Errorf("database.time_zone: %w", err)
+	}
+
+	if config.ArchiveDatabase != nil {
+		if err := validateArchiveDatabase("archive_database", config.ArchiveDatabase); err != nil {
+			return err
+		}
 	}
 
 	// Validate each table
@@ -84,10 +148,390 @@ func validateConfig(config *types.Config) error {
 		if table.Name == "" {
 			return fmt.Errorf("table[%d].name is required", i)
 		}
-		if table.Enabled && table.SplitColumn == "" {
-			return fmt.Errorf("table[%d].split_column is required when enabled", i)
+		if table.Enabled && table.SplitColumn == "" && table.SplitVia == nil {
+			return fmt.Errorf("table[%d].split_column (or split_via) is required when enabled", i)
+		}
+		if table.SplitVia != nil {
+			if err := validateSplitVia(i, &table); err != nil {
+				return err
+			}
+		}
+		if err := validateGranularity(i, &config.Tables[i], config); err != nil {
+			return err
+		}
+		split, err := database.ParseSplitType(&config.Tables[i])
+		if err != nil {
+			return fmt.Errorf("table[%d]: %w", i, err)
+		}
+		if err := split.CheckGranularity(config.Tables[i].Granularity); err != nil {
+			return fmt.Errorf("table[%d]: %w", i, err)
+		}
+		if strings.TrimSpace(table.Where) != "" {
+			if _, err := database.ParseRowCondition(table.Where); err != nil {
+				return fmt.Errorf("table[%d].where is invalid: %w", i, err)
+			}
+		}
+		if table.Enabled {
+			if err := validateChildren(fmt.Sprintf("table[%d].children", i), table.Children, config); err != nil {
+				return err
+			}
+		}
+		if table.ArchiveDatabase != nil {
+			if err := validateArchiveDatabase(fmt.Sprintf("table[%d].archive_database", i), table.ArchiveDatabase); err != nil {
+				return err
+			}
+		}
+		if table.Export != nil {
+			if err := validateExport(fmt.Sprintf("table[%d].export", i), table.Export); err != nil {
+				return err
+			}
+		}
+	}
+
+	if config.Archive.Options.Export != nil {
+		if err := validateExport("archive.options.export", config.Archive.Options.Export); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// validateYears checks the bounds of years: auto
+func validateYears(years *types.Years) error {
+	if !years.Auto {
+		if years.Min != 0 || years.Max != 0 || years.ExcludeCurrent {
+			return fmt.Errorf("archive.years: min, max and exclude_current need auto: true")
+		}
+		return nil
+	}
+	if years.Min != 0 && years.Max != 0 && years.Min > years.Max {
+		return fmt.Errorf("archive.years: min %d is after max %d", years.Min, years.Max)
+	}
+	return nil
+}
+
+// validateResume checks that a resume position names one table/period and
+// its key, and normalizes the period label. Whether the table and period are
+// part of the run is checked when the run is planned.
+func validateResume(config *types.Config) error {
+	resume := config.Archive.Options.Resume
+	if resume == nil {
+		return nil
+	}
+	if resume.Table == "" || resume.Period == "" || len(resume.Key) == 0 {
+		return fmt.Errorf("needs table, period and key (e.g. {table: orders, period: \"2024\", key: [\"1042\"]})")
+	}
+	resume.Period = strings.ToUpper(strings.TrimSpace(resume.Period))
+	if strings.Contains(resume.Period, "..") {
+		return fmt.Errorf("period must be a single period, not a range (got %q)", resume.Period)
+	}
+	return nil
+}
+
+// validateChildren checks the explicit children of a table (recursively).
+// A child is archived through its parent, so it may not also be an enabled
+// table of its own.
+func validateChildren(field string, children types.Children, config *types.Config) error {
+	names := make(map[string]bool)
+	for j, child := range children.List {
+		childField := fmt.Sprintf("%s[%d]", field, j)
+		if child.Name == "" {
+			return fmt.Errorf("%s.name is required", childField)
+		}
+		if child.Key == "" {
+			return fmt.Errorf("%s.key is required (the column of %s referencing its parent)", childField, child.Name)
+		}
+		if names[child.Name] {
+			return fmt.Errorf("%s: child %s is listed twice", childField, child.Name)
+		}
+		names[child.Name] = true
+		for _, table := range config.Tables {
+			if table.Enabled && table.Name == child.Name {
+				return fmt.Errorf("%s: %s is also an enabled table; archive it either as a child or on its own", childField, child.Name)
+			}
+		}
+		if err := validateChildren(childField+".children", child.Children, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSplitVia checks that split_via names the parent table, the key
+// referencing it and its date column, in place of split_column
+func validateSplitVia(i int, table *types.Table) error {
+	via := table.SplitVia
+	if table.SplitColumn != "" {
+		return fmt.Errorf("table[%d]: split_column and split_via are mutually exclusive", i)
+	}
+	if via.Table == "" || via.Key == "" || via.Column == "" {
+		return fmt.Errorf("table[%d].split_via needs table, key and column (e.g. {table: invoices, key: invoice_id, column: issued_at})", i)
+	}
+	if via.Table == table.Name {
+		return fmt.Errorf("table[%d].split_via must name another table", i)
+	}
+	return nil
+}
+
+// validateGranularity checks the granularity, fiscal year start, periods and
+// archive_pattern placeholders of a table and normalizes the granularity and
+// fiscal year start
+func validateGranularity(i int, table *types.Table, config *types.Config) error {
+	table.Granularity = strings.ToLower(strings.TrimSpace(table.Granularity))
+	if table.Granularity == "" {
+		table.Granularity = database.GranularityYear
+	}
+	if !database.ValidGranularity(table.Granularity) {
+		return fmt.Errorf("table[%d].granularity must be year, quarter, month or day (got %q)", i, table.Granularity)
+	}
+
+	// Tables without their own fiscal_year_start use archive.fiscal_year_start
+	if table.FiscalYearStart == 0 {
+		table.FiscalYearStart = config.Archive.FiscalYearStart
+	}
+	if table.FiscalYearStart == 0 {
+		table.FiscalYearStart = 1
+	}
+	if table.FiscalYearStart < 1 || table.FiscalYearStart > 12 {
+		return fmt.Errorf("table[%d].fiscal_year_start must be a month between 1 and 12 (got %d)", i, table.FiscalYearStart)
+	}
+
+	if err := database.CheckPatternGranularity(table.ArchivePattern, table.Granularity); err != nil {
+		return fmt.Errorf("table[%d].archive_pattern: %w", i, err)
+	}
+	export := table.Export
+	if export == nil {
+		export = config.Archive.Options.Export
+	}
+	if export != nil && export.Upload != nil {
+		if err := database.CheckPatternGranularity(export.Upload.KeyPattern, table.Granularity); err != nil {
+			return fmt.Errorf("table[%d]: export.upload.key_pattern: %w", i, err)
+		}
+	}
+
+	if _, err := database.TablePeriods(table, config.Archive.Years.List); err != nil {
+		return fmt.Errorf("table[%d].periods: %w", i, err)
+	}
+
+	if table.Retention != nil {
+		if len(table.Periods) > 0 {
+			return fmt.Errorf("table[%d]: retention and periods cannot be combined", i)
+		}
+		if err := database.ValidateRetention(table.Retention); err != nil {
+			return fmt.Errorf("table[%d].retention: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateExport checks an export block and normalizes its values
+func validateExport(field string, export *types.Export) error {
+	export.Format = strings.ToLower(export.Format)
+	if !database.ValidExportFormat(export.Format) {
+		return fmt.Errorf("%s.format must be csv, ndjson or parquet (got %q)", field, export.Format)
+	}
+
+	export.Compression = strings.ToLower(export.Compression)
+	switch export.Compression {
+	case "":
+		export.Compression = "gzip"
+		if export.Format == "parquet" {
+			export.Compression = "snappy"
+		}
+	case "gzip", "zstd", "none":
+	case "snappy":
+		if export.Format != "parquet" {
+			return fmt.Errorf("%s.compression snappy is only supported for parquet", field)
+		}
+	default:
+		return fmt.Errorf("%s.compression must be one of gzip, zstd, snappy (parquet), none (got %q)", field, export.Compression)
+	}
+
+	if export.MaxFileSizeMB < 0 {
+		return fmt.Errorf("%s.max_file_size_mb must not be negative", field)
+	}
+	if export.RowGroupSizeMB < 0 {
+		return fmt.Errorf("%s.row_group_size_mb must not be negative", field)
+	}
+	if export.RowGroupSizeMB > 0 && export.Format != "parquet" {
+		return fmt.Errorf("%s.row_group_size_mb is only used for parquet", field)
+	}
+
+	if export.Upload != nil {
+		return validateUpload(field+".upload", export.Upload)
+	}
+
+	return nil
+}
+
+// validateUpload checks an export upload block
+func validateUpload(field string, upload *types.Upload) error {
+	if upload.Endpoint == "" {
+		return fmt.Errorf("%s.endpoint is required", field)
+	}
+	if strings.Contains(upload.Endpoint, "://") {
+		return fmt.Errorf("%s.endpoint must be host[:port] without a scheme (use disable_tls for http)", field)
+	}
+	if upload.Bucket == "" {
+		return fmt.Errorf("%s.bucket is required", field)
+	}
+	if upload.PartSizeMB != 0 && upload.PartSizeMB < 5 {
+		return fmt.Errorf("%s.part_size_mb must be at least 5 (S3 minimum part size)", field)
+	}
+	if upload.MaxRetries < 0 {
+		return fmt.Errorf("%s.max_retries must not be negative", field)
+	}
+	return nil
+}
+
+// validateArchiveDatabase checks an archive_database block. Fields left empty
+// are inherited (see resolveArchiveDatabases), so only set values are checked.
+func validateArchiveDatabase(field string, archive *types.Database) error {
+	if archive.Type != "" {
+		if _, err := database.LookupDialect(archive.Type); err != nil {
+			return fmt.Errorf("%s.type: %w", field, err)
+		}
+	}
+
+	if archive.SourceDB != "" {
+		return fmt.Errorf("%s.source_db is not used; archive database names come from archive_pattern", field)
+	}
+	if archive.TimeZone != "" {
+		return fmt.Errorf("%s.time_zone is not used; archives share database.time_zone so period boundaries match", field)
+	}
+
+	return validateTLS(field+".tls", archive.TLS)
+}
+
+// validateTLS checks a tls setting against the values buildDSN understands
+func validateTLS(field string, tls string) error {
+	switch tls {
+	case "", "disable", "preferred", "skip-verify", "verify-full":
+		return nil
+	default:
+		return fmt.Errorf("%s must be one of disable, preferred, skip-verify, verify-full (got %q)", field, tls)
+	}
+}
+
+// resolveArchiveDatabases stores the effective archive connection settings on
+// every table: the table override, then the top-level archive_database, then
+// the source database. Empty fields fall through to the next level.
+func resolveArchiveDatabases(config *types.Config) {
+	base := mergeDatabase(config.Database, config.ArchiveDatabase)
+	base.SourceDB = ""
+
+	for i := range config.Tables {
+		resolved := mergeDatabase(base, config.Tables[i].ArchiveDatabase)
+		config.Tables[i].ArchiveDatabase = &resolved
+	}
+}
+
+// resolveSplitVia links tables with split_via to their parent table, whose
+// date column (and where) selects their rows. The parent of an enabled table
+// must be archived alongside it: the archive counts (and restores) of the
+// table join to the parent rows in the same archive database.
+func resolveSplitVia(config *types.Config) error {
+	for i := range config.Tables {
+		table := &config.Tables[i]
+		via := table.SplitVia
+		if via == nil {
+			continue
+		}
+		var archived *types.Table
+		for j := range config.Tables {
+			if config.Tables[j].Name == via.Table {
+				archived = &config.Tables[j]
+				break
+			}
+		}
+		if table.Enabled {
+			if err := checkSplitViaParent(i, table, archived); err != nil {
+				return err
+			}
+		}
+
+		parent := &types.Table{
+			Name:            via.Table,
+			SplitColumn:     via.Column,
+			SplitType:       table.SplitType,
+			SplitFormat:     table.SplitFormat,
+			Granularity:     table.Granularity,
+			FiscalYearStart: table.FiscalYearStart,
+			TimeZone:        table.TimeZone,
+		}
+		// Only lines of archived parent rows are selected
+		if archived != nil {
+			parent.Where = archived.Where
+		}
+		table.Parent = &types.ParentLink{Parent: parent, Key: via.Key, ParentKey: via.ParentKey}
+	}
+	return nil
+}
+
+// checkSplitViaParent checks that the split_via parent of an enabled table is
+// an enabled table archived by the same column into the same archive
+// databases (parent is nil when it is not configured)
+func checkSplitViaParent(i int, table *types.Table, parent *types.Table) error {
+	via := table.SplitVia
+	switch {
+	case parent == nil || !parent.Enabled:
+		return fmt.Errorf("table[%d].split_via: %s must be an enabled table archived in the same run", i, via.Table)
+	case parent.SplitColumn != via.Column:
+		return fmt.Errorf("table[%d].split_via.column %s must be the split_column of %s (got %q)", i, via.Column, via.Table, parent.SplitColumn)
+	case table.Export != nil:
+		// Exports are checked against their manifest, not the archive
+		return nil
+	case parent.Export != nil:
+		return fmt.Errorf("table[%d].split_via: %s is exported to files; %s must be exported as well", i, via.Table, table.Name)
+	case archiveTarget(parent) != archiveTarget(table):
+		return fmt.Errorf("table[%d].split_via: archive_pattern %q must name the same archive databases as archive_pattern %q of %s", i, table.ArchivePattern, parent.ArchivePattern, via.Table)
+	case *parent.ArchiveDatabase != *table.ArchiveDatabase:
+		return fmt.Errorf("table[%d].split_via: archive_database must match the archive_database of %s", i, via.Table)
+	}
+	return nil
+}
+
+// archiveTarget is the archive_pattern of a table with its name filled in,
+// naming the same databases for every period as the pattern does
+func archiveTarget(table *types.Table) string {
+	return strings.ReplaceAll(table.ArchivePattern, "{table}", table.Name)
+}
+
+// resolveExports applies archive.options.export to tables without their own
+// export block, so table.Export is the effective setting
+func resolveExports(config *types.Config) {
+	for i := range config.Tables {
+		if config.Tables[i].Export == nil {
+			config.Tables[i].Export = config.Archive.Options.Export
+		}
+	}
+}
+
+// mergeDatabase returns base with the non-empty fields of override applied
+func mergeDatabase(base types.Database, override *types.Database) types.Database {
+	if override == nil {
+		return base
+	}
+
+	if override.Type != "" {
+		base.Type = override.Type
+	}
+	if override.Host != "" {
+		base.Host = override.Host
+	}
+	if override.Port != 0 {
+		base.Port = override.Port
+	}
+	if override.User != "" {
+		base.User = override.User
+	}
+	if override.Password != "" {
+		base.Password = override.Password
+	}
+	if override.TLS != "" {
+		base.TLS = override.TLS
+	}
+
+	return base
+}
@@ -3,78 +3,186 @@ package database
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strings"
 
 	"data-splitter/pkg/types"
 
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 // ConnectSourceDB establishes connection to the source database
 func ConnectSourceDB(config *types.Database) (*gorm.DB, error) {
-	dsn := buildDSN(config, config.SourceDB)
-
-	// Control GORM SQL logging via environment variable LOG_LEVEL.
-	// Default: silent (avoid noisy SELECT logs). Enable verbose SQL output
-	// only when explicitly asked (LOG_LEVEL=debug).
-	logLevel := strings.ToLower(os.Getenv("LOG_LEVEL"))
-	gormLogMode := logger.Silent
-	if logLevel == "debug" {
-		gormLogMode = logger.Info
+	dialect, err := LookupDialect(config.Type)
+	if err != nil {
+		return nil, err
 	}
 
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(gormLogMode),
-	})
+	db, err := openDB(dialect, config, config.SourceDB)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to source database: %w", err)
 	}
 
-	log.Printf("Connected to source database: %s", config.SourceDB)
+	log.Printf("Connected to source database: %s (%s)", config.SourceDB, dialect.Name())
 	return db, nil
 }
 
-// ConnectArchiveDB establishes connection to the archive database
-func ConnectArchiveDB(config *types.Database, table *types.Table, year int) (*gorm.DB, error) {
-	archiveDB := BuildArchiveDBName(table.ArchivePattern, year)
-	dsn := buildDSN(config, archiveDB)
+// ConnectArchiveDB establishes connection to the archive database. config
+// holds the archive server settings (see types.Table.ArchiveDatabase).
+func ConnectArchiveDB(config *types.Database, table *types.Table, period Period) (*gorm.DB, error) {
+	archiveDB := BuildArchiveDBName(table.ArchivePattern, table.Name, period)
+	dialect, err := ArchiveDialect(config, archiveDB)
+	if err != nil {
+		return nil, err
+	}
 
-	// Mirror the same GORM log level selection as ConnectSourceDB
+	db, err := openDB(dialect, config, archiveDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to archive database %s: %w", archiveDB, err)
+	}
+
+	log.Printf("Connected to archive database: %s on %s (%s)", archiveDB, config.Host, dialect.Name())
+	return db, nil
+}
+
+// ConnectArchiveServer connects to the archive server without selecting an
+// archive database, e.g. to create one
+func ConnectArchiveServer(config *types.Database) (*gorm.DB, error) {
+	dialect, err := LookupDialect(config.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openDB(dialect, config, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to archive server %s: %w", config.Host, err)
+	}
+
+	return db, nil
+}
+
+// openDB opens a GORM connection through the dialect and attaches the
+// dialect to it (see DialectOf)
+func openDB(dialect Dialect, config *types.Database, database string) (*gorm.DB, error) {
+	// Control GORM SQL logging via environment variable LOG_LEVEL.
+	// Default: silent (avoid noisy SELECT logs). Enable verbose SQL output
+	// only when explicitly asked (LOG_LEVEL=debug).
 	logLevel := strings.ToLower(os.Getenv("LOG_LEVEL"))
 	gormLogMode := logger.Silent
 	if logLevel == "debug" {
 		gormLogMode = logger.Info
 	}
 
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
+	db, err := gorm.Open(dialect.Open(config, database), &gorm.Config{
 		Logger: logger.Default.LogMode(gormLogMode),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to archive database %s: %w", archiveDB, err)
+		return nil, err
+	}
+	if err := db.Use(dialectPlugin{dialect: dialect}); err != nil {
+		return nil, fmt.Errorf("failed to register %s dialect: %w", dialect.Name(), err)
 	}
 
-	log.Printf("Connected to archive database: %s", archiveDB)
 	return db, nil
 }
 
-// BuildArchiveDBName constructs the archive database name from pattern
-func BuildArchiveDBName(pattern string, year int) string {
-	// Replace {year} placeholder with actual year
-	return strings.Replace(pattern, "{year}", fmt.Sprintf("%d", year), -1)
+// BuildArchiveDBName constructs the archive database name (or SQLite file
+// path) from pattern
+func BuildArchiveDBName(pattern string, tableName string, period Period) string {
+	// Replace {table} and the period placeholders with actual values
+	name := strings.Replace(pattern, "{table}", tableName, -1)
+	name = strings.Replace(name, "{year}", fmt.Sprintf("%d", period.Year()), -1)
+	name = strings.Replace(name, "{quarter}", fmt.Sprintf("%d", period.Quarter()), -1)
+	name = strings.Replace(name, "{month}", fmt.Sprintf("%02d", period.Month()), -1)
+	return strings.Replace(name, "{day}", fmt.Sprintf("%02d", period.Day()), -1)
+}
+
+// ArchiveDialect returns the dialect of a resolved archive target: SQLite
+// file paths (see IsSQLiteArchive) use SQLite, anything else is a database on
+// the archive server described by config (the table's archive_database, which
+// defaults to the source server) using its type.
+func ArchiveDialect(config *types.Database, archiveName string) (Dialect, error) {
+	if IsSQLiteArchive(archiveName) {
+		return sqliteDialect{}, nil
+	}
+	return LookupDialect(config.Type)
 }
 
 // buildDSN constructs the database connection string
 func buildDSN(config *types.Database, database string) string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local&sql_mode=STRICT_ALL_TABLES",
+	port := config.Port
+	if port == 0 {
+		port = 3306
+	}
+
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&sql_mode=STRICT_ALL_TABLES",
 		config.User,
 		config.Password,
 		config.Host,
-		config.Port,
+		port,
 		database,
 	)
+
+	// Read DATETIME values in the business time zone (not the runner's
+	// Local) and make it the session time zone; the zone was validated when
+	// the config was loaded
+	if loc, err := LoadTimeZone(config.TimeZone); err == nil {
+		dsn += "&loc=" + url.QueryEscape(loc.String())
+		if config.TimeZone != "" {
+			dsn += "&time_zone=" + url.QueryEscape("'"+mysqlSessionTimeZone(loc)+"'")
+		}
+	}
+
+	// Map the engine-neutral tls setting onto go-sql-driver/mysql values
+	switch strings.ToLower(config.TLS) {
+	case "disable":
+		dsn += "&tls=false"
+	case "preferred":
+		dsn += "&tls=preferred"
+	case "skip-verify":
+		dsn += "&tls=skip-verify"
+	case "verify-full":
+		dsn += "&tls=true"
+	}
+
+	return dsn
+}
+
+// buildPostgresDSN constructs a PostgreSQL connection URL. The URL form is used
+// (rather than key=value) so credentials containing spaces or quotes are escaped.
+func buildPostgresDSN(config *types.Database, database string) string {
+	port := config.Port
+	if port == 0 {
+		port = 5432
+	}
+
+	// Map the engine-neutral tls setting onto libpq sslmode values
+	sslMode := "prefer"
+	switch strings.ToLower(config.TLS) {
+	case "disable":
+		sslMode = "disable"
+	case "skip-verify":
+		sslMode = "require"
+	case "verify-full":
+		sslMode = "verify-full"
+	}
+
+	query := url.Values{"sslmode": {sslMode}}
+	// Session time zone for timestamptz comparisons (see types.Database.TimeZone)
+	if config.TimeZone != "" {
+		query.Set("timezone", config.TimeZone)
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(config.User, config.Password),
+		Host:     fmt.Sprintf("%s:%d", config.Host, port),
+		Path:     "/" + database,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String()
 }
 
 // TestConnection tests the database connection
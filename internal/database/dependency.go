@@ -0,0 +1,105 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DependencyOrder orders tables so that every table comes after the tables
+// its foreign keys reference. tables[i] lists the names archived by the i-th
+// table (the table and its children); keys between names of the same entry
+// and keys to tables outside the list are ignored. Ties keep the given
+// order. The result holds indexes into tables, parents first; a cycle is
+// returned as an error naming its tables.
+func DependencyOrder(keys []ForeignKey, tables [][]string) ([]int, error) {
+	owner := make(map[string]int)
+	for i, names := range tables {
+		for _, name := range names {
+			owner[name] = i
+		}
+	}
+
+	// parents[i] holds the tables i references
+	parents := make([]map[int]bool, len(tables))
+	for i := range parents {
+		parents[i] = make(map[int]bool)
+	}
+	for _, fk := range keys {
+		child, ok := owner[fk.Table]
+		if !ok {
+			continue
+		}
+		parent, ok := owner[fk.RefTable]
+		if !ok || parent == child {
+			continue
+		}
+		parents[child][parent] = true
+	}
+
+	// Repeatedly take the first table (in config order) whose parents are done
+	done := make([]bool, len(tables))
+	var order []int
+	for len(order) < len(tables) {
+		next := -1
+		for i := range tables {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for parent := range parents[i] {
+				if !done[parent] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, fmt.Errorf("foreign keys form a cycle: %s", dependencyCycle(parents, done, tables))
+		}
+		done[next] = true
+		order = append(order, next)
+	}
+	return order, nil
+}
+
+// dependencyCycle finds a cycle among the tables not yet ordered and renders
+// it as "a -> b -> a" (a references b, b references a)
+func dependencyCycle(parents []map[int]bool, done []bool, tables [][]string) string {
+	start := -1
+	for i := range tables {
+		if !done[i] {
+			start = i
+			break
+		}
+	}
+
+	// Every remaining table has a remaining parent, so walking parents must
+	// revisit a table
+	position := make(map[int]int)
+	var path []int
+	for current := start; ; {
+		if at, seen := position[current]; seen {
+			path = append(path[at:], current)
+			break
+		}
+		position[current] = len(path)
+		path = append(path, current)
+		next := -1
+		for parent := range parents[current] {
+			if !done[parent] && (next < 0 || parent < next) {
+				next = parent
+			}
+		}
+		current = next
+	}
+
+	names := make([]string, len(path))
+	for i, index := range path {
+		names[i] = tables[index][0]
+	}
+	return strings.Join(names, " -> ")
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func fk(table, refTable string) ForeignKey {
+	return ForeignKey{Table: table, Columns: []string{refTable + "_id"}, RefTable: refTable}
+}
+
+func TestDependencyOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   []ForeignKey
+		tables [][]string
+		want   []int
+	}{
+		{
+			name:   "no keys keep the given order",
+			tables: [][]string{{"payments"}, {"orders"}, {"customers"}},
+			want:   []int{0, 1, 2},
+		},
+		{
+			name:   "parents first",
+			keys:   []ForeignKey{fk("payments", "orders"), fk("orders", "customers")},
+			tables: [][]string{{"payments"}, {"orders"}, {"customers"}},
+			want:   []int{2, 1, 0},
+		},
+		{
+			name:   "ties keep the given order",
+			keys:   []ForeignKey{fk("orders", "customers")},
+			tables: [][]string{{"orders"}, {"audit"}, {"customers"}, {"logs"}},
+			want:   []int{1, 2, 0, 3},
+		},
+		{
+			name:   "keys within an entry are ignored",
+			keys:   []ForeignKey{fk("order_items", "orders"), fk("orders", "order_items")},
+			tables: [][]string{{"orders", "order_items"}, {"customers"}},
+			want:   []int{0, 1},
+		},
+		{
+			name:   "children order their entry",
+			keys:   []ForeignKey{fk("order_items", "products")},
+			tables: [][]string{{"orders", "order_items"}, {"products"}},
+			want:   []int{1, 0},
+		},
+		{
+			name:   "keys to other tables are ignored",
+			keys:   []ForeignKey{fk("orders", "customers"), fk("orders", "orders")},
+			tables: [][]string{{"orders"}},
+			want:   []int{0},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := DependencyOrder(tt.keys, tt.tables)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: order = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDependencyOrderCycle(t *testing.T) {
+	tests := []struct {
+		keys    []ForeignKey
+		tables  [][]string
+		wantErr string
+	}{
+		{
+			keys:    []ForeignKey{fk("a", "b"), fk("b", "a")},
+			tables:  [][]string{{"a"}, {"b"}},
+			wantErr: "foreign keys form a cycle: a -> b -> a",
+		},
+		{
+			keys:    []ForeignKey{fk("a", "b"), fk("b", "c"), fk("c", "b")},
+			tables:  [][]string{{"a"}, {"b"}, {"c"}},
+			wantErr: "foreign keys form a cycle: b -> c -> b",
+		},
+		{
+			// A cycle through a child is reported by the table archiving it
+			keys:    []ForeignKey{fk("items", "products"), fk("products", "orders")},
+			tables:  [][]string{{"orders", "items"}, {"products"}},
+			wantErr: "foreign keys form a cycle: orders -> products -> orders",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := DependencyOrder(tt.keys, tt.tables)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("DependencyOrder(%v) error = %v, want %q", tt.tables, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/gorm"
+)
+
+// Dialect captures everything engine-specific about the SQL this tool
+// generates. Every query builder in this package goes through the dialect of
+// the connection it targets, so supporting a new engine only requires a new
+// Dialect implementation registered in the dialects map below.
+type Dialect interface {
+	// Name returns the canonical database.type value for the engine
+	Name() string
+	// Open returns the GORM dialector connecting to the named database
+	Open(config *types.Database, database string) gorm.Dialector
+	// QuoteIdent quotes a table or column name
+	QuoteIdent(name string) string
+	// Placeholder returns the bind placeholder for the n-th (1-based)
+	// parameter of a statement executed through database/sql
+	Placeholder(n int) string
+	// UpsertClause returns the clause appended to an INSERT so that rows
+	// whose key already exists are updated (or skipped) instead of failing.
+	// Column names are passed already quoted.
+	UpsertClause(keyColumns []string, updateColumns []string) string
+	// InsertLimits returns the most bind parameters and bytes one statement
+	// may carry on the connected server; maxBytes is 0 when only the
+	// parameter count matters
+	InsertLimits(db *gorm.DB) (maxParams int, maxBytes int, err error)
+	// CreateDatabase creates the named database if it does not exist
+	CreateDatabase(db *gorm.DB, name string) error
+	// CreateDatabaseSQL returns the statement creating the named database,
+	// or "" when the engine has none (SQLite files are created on open)
+	CreateDatabaseSQL(name string) string
+	// Literal renders a scanned value as an SQL literal for generated
+	// scripts; binary values are rendered in the engine's hex syntax
+	Literal(v interface{}, binary bool) string
+	// TableExists reports whether a table exists in the connected database
+	TableExists(db *gorm.DB, tableName string) (bool, error)
+	// GetTableSchema returns a CREATE TABLE statement for the table
+	GetTableSchema(db *gorm.DB, tableName string) (string, error)
+	// GetTableColumns returns the columns of the table in ordinal order
+	GetTableColumns(db *gorm.DB, tableName string) ([]ColumnInfo, error)
+	// GetPrimaryKeyColumns returns the primary key columns in key order
+	GetPrimaryKeyColumns(db *gorm.DB, tableName string) ([]string, error)
+	// ForeignKeys returns the foreign keys declared in the connected database
+	ForeignKeys(db *gorm.DB) ([]ForeignKey, error)
+	// ColumnType renders a source column type for an archive created by
+	// this dialect when the source uses a different engine
+	ColumnType(column string, t LogicalType) ColumnType
+	// SnapshotTxOptions returns the options of a read-only transaction whose
+	// reads all see one consistent snapshot, or nil when the engine has none
+	SnapshotTxOptions() *sql.TxOptions
+	// DisableConstraints relaxes constraint checking for a bulk load and
+	// returns a function restoring the previous behaviour
+	DisableConstraints(conn sqlExecer) (restore func())
+}
+
+// sqlExecer is the subset of *sql.DB / *sql.Conn / *sql.Tx used for raw statements
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// dialects maps database.type values (and their aliases) to implementations
+var dialects = map[string]Dialect{
+	"mysql":      mysqlDialect{},
+	"mariadb":    mysqlDialect{},
+	"postgres":   postgresDialect{},
+	"postgresql": postgresDialect{},
+	"pgsql":      postgresDialect{},
+	"sqlite":     sqliteDialect{},
+	"sqlite3":    sqliteDialect{},
+}
+
+// LookupDialect returns the dialect for a configured database.type
+func LookupDialect(dbType string) (Dialect, error) {
+	if dialect, ok := dialects[strings.ToLower(strings.TrimSpace(dbType))]; ok {
+		return dialect, nil
+	}
+
+	var supported []string
+	for name := range dialects {
+		supported = append(supported, name)
+	}
+	sort.Strings(supported)
+	return nil, fmt.Errorf("unsupported database type %q (supported: %s)", dbType, strings.Join(supported, ", "))
+}
+
+// dialectPluginName is the key under which a connection's dialect is stored
+// in gorm.Config.Plugins. The plugin map is shared by every session derived
+// from the connection, so the dialect follows the connection around.
+const dialectPluginName = "data-splitter:dialect"
+
+// dialectPlugin attaches a Dialect to a *gorm.DB
+type dialectPlugin struct {
+	dialect Dialect
+}
+
+func (dialectPlugin) Name() string              { return dialectPluginName }
+func (dialectPlugin) Initialize(*gorm.DB) error { return nil }
+
+// DialectOf returns the dialect chosen from config when the connection was
+// opened. Connections not opened through this package default to MySQL.
+func DialectOf(db *gorm.DB) Dialect {
+	if plugin, ok := db.Config.Plugins[dialectPluginName].(dialectPlugin); ok {
+		return plugin.dialect
+	}
+	return mysqlDialect{}
+}
+
+// quoteIdentList quotes and comma-joins a list of identifiers
+func quoteIdentList(dialect Dialect, names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = dialect.QuoteIdent(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// onConflictClause builds the ON CONFLICT upsert shared by PostgreSQL and
+// SQLite. An explicit conflict target is needed to update; without a primary
+// key the best we can do is skip rows that violate a constraint.
+func onConflictClause(keyColumns []string, updateColumns []string) string {
+	if len(keyColumns) == 0 || len(updateColumns) == 0 {
+		return " ON CONFLICT DO NOTHING"
+	}
+
+	var updateParts []string
+	for _, column := range updateColumns {
+		updateParts = append(updateParts, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+	}
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(keyColumns, ", "), strings.Join(updateParts, ", "))
+}
+
+// renderLiteral holds the engine-neutral part of Dialect.Literal; quote and
+// hexLiteral supply the engine's string and binary syntax
+func renderLiteral(v interface{}, binary bool, quote func(string) string, hexLiteral func([]byte) string, timeLayout string) string {
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if x {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case int32:
+		return strconv.FormatInt(int64(x), 10)
+	case int:
+		return strconv.Itoa(x)
+	case uint64:
+		return strconv.FormatUint(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'g', -1, 32)
+	case time.Time:
+		return quote(x.Format(timeLayout))
+	case []byte:
+		if binary {
+			return hexLiteral(x)
+		}
+		return quote(string(x))
+	case string:
+		return quote(x)
+	default:
+		return quote(fmt.Sprint(x))
+	}
+}
@@ -0,0 +1,257 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// mysqlDialect implements Dialect for MySQL and MariaDB
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) Open(config *types.Database, database string) gorm.Dialector {
+	return mysql.Open(buildDSN(config, database))
+}
+
+func (mysqlDialect) QuoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (mysqlDialect) Placeholder(n int) string { return "?" }
+
+func (mysqlDialect) UpsertClause(keyColumns []string, updateColumns []string) string {
+	if len(updateColumns) == 0 {
+		return ""
+	}
+
+	var updateParts []string
+	for _, column := range updateColumns {
+		updateParts = append(updateParts, fmt.Sprintf("%s = VALUES(%s)", column, column))
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(updateParts, ", ")
+}
+
+// mysqlMaxPacket is the go-sql-driver default client-side packet limit,
+// which applies on top of the server's max_allowed_packet
+const mysqlMaxPacket = 64 << 20
+
+// InsertLimits reads max_allowed_packet; prepared statements take at most
+// 65535 parameters
+func (mysqlDialect) InsertLimits(db *gorm.DB) (int, int, error) {
+	var packet int64
+	if err := db.Raw("SELECT @@max_allowed_packet").Scan(&packet).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to read max_allowed_packet: %w", err)
+	}
+	if packet <= 0 || packet > mysqlMaxPacket {
+		packet = mysqlMaxPacket
+	}
+	return 65535, int(packet), nil
+}
+
+func (d mysqlDialect) CreateDatabaseSQL(name string) string {
+	return fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", d.QuoteIdent(name))
+}
+
+// Literal escapes backslashes as well, since MySQL treats them as escape
+// characters unless NO_BACKSLASH_ESCAPES is set
+func (mysqlDialect) Literal(v interface{}, binary bool) string {
+	quote := func(s string) string {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	hexLiteral := func(b []byte) string { return "X'" + hex.EncodeToString(b) + "'" }
+	return renderLiteral(v, binary, quote, hexLiteral, "2006-01-02 15:04:05.999999")
+}
+
+func (d mysqlDialect) CreateDatabase(db *gorm.DB, name string) error {
+	createDBSQL := d.CreateDatabaseSQL(name)
+	if err := db.Exec(createDBSQL).Error; err != nil {
+		return fmt.Errorf("failed to create archive database %s: %w", name, err)
+	}
+
+	log.Printf("Archive database %s created or already exists", name)
+	return nil
+}
+
+func (mysqlDialect) TableExists(db *gorm.DB, tableName string) (bool, error) {
+	var count int64
+	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+
+	if err := db.Raw(query, tableName).Scan(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check if table %s exists: %w", tableName, err)
+	}
+
+	return count > 0, nil
+}
+
+func (d mysqlDialect) GetTableSchema(db *gorm.DB, tableName string) (string, error) {
+	var createTableSQL string
+	query := fmt.Sprintf("SHOW CREATE TABLE %s", d.QuoteIdent(tableName))
+	row := db.Raw(query).Row()
+
+	if err := row.Scan(&tableName, &createTableSQL); err != nil {
+		return "", fmt.Errorf("failed to get schema for table %s: %w", tableName, err)
+	}
+
+	return createTableSQL, nil
+}
+
+func (d mysqlDialect) GetTableColumns(db *gorm.DB, tableName string) ([]ColumnInfo, error) {
+	var columns []ColumnInfo
+	query := fmt.Sprintf("DESCRIBE %s", d.QuoteIdent(tableName))
+
+	rows, err := db.Raw(query).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe table %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var col ColumnInfo
+		if err := rows.Scan(&col.Field, &col.Type, &col.Null, &col.Key, &col.Default, &col.Extra); err != nil {
+			return nil, fmt.Errorf("failed to scan column info: %w", err)
+		}
+		columns = append(columns, col)
+	}
+
+	return columns, nil
+}
+
+// mysqlPrimaryKeyQuery lists the primary key columns of a table in key
+// order. information_schema has the same shape on every MySQL/MariaDB
+// version, unlike SHOW KEYS.
+const mysqlPrimaryKeyQuery = `SELECT COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'
+		ORDER BY ORDINAL_POSITION`
+
+func (mysqlDialect) GetPrimaryKeyColumns(db *gorm.DB, tableName string) ([]string, error) {
+	rows, err := db.Raw(mysqlPrimaryKeyQuery, tableName).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get primary keys for table %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	var primaryKeys []string
+	for rows.Next() {
+		var columnName string
+		if err := rows.Scan(&columnName); err != nil {
+			return nil, fmt.Errorf("failed to scan primary key info: %w", err)
+		}
+		primaryKeys = append(primaryKeys, columnName)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read primary keys for table %s: %w", tableName, err)
+	}
+
+	return primaryKeys, nil
+}
+
+func (mysqlDialect) ForeignKeys(db *gorm.DB) ([]ForeignKey, error) {
+	query := `SELECT CONSTRAINT_NAME, TABLE_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION`
+	return scanForeignKeys(db, query)
+}
+
+// SnapshotTxOptions uses REPEATABLE READ: InnoDB reads of the transaction
+// share the snapshot taken at its first read
+func (mysqlDialect) SnapshotTxOptions() *sql.TxOptions {
+	return &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+}
+
+// DisableConstraints uses CHECK_CONSTRAINT_CHECKS to bypass CHECK constraints
+// and FOREIGN_KEY_CHECKS so children can be loaded before their parents
+func (mysqlDialect) DisableConstraints(conn sqlExecer) func() {
+	if _, err := conn.Exec("SET CHECK_CONSTRAINT_CHECKS = 0"); err != nil {
+		log.Printf("WARNING: Failed to disable MySQL constraints: %v", err)
+	}
+	if _, err := conn.Exec("SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+		log.Printf("WARNING: Failed to disable MySQL foreign key checks: %v", err)
+	}
+	return func() {
+		if _, err := conn.Exec("SET CHECK_CONSTRAINT_CHECKS = 1"); err != nil {
+			log.Printf("WARNING: Failed to re-enable MySQL constraints: %v", err)
+		}
+		if _, err := conn.Exec("SET FOREIGN_KEY_CHECKS = 1"); err != nil {
+			log.Printf("WARNING: Failed to re-enable MySQL foreign key checks: %v", err)
+		}
+	}
+}
+
+func (mysqlDialect) ColumnType(column string, t LogicalType) ColumnType {
+	switch t.Kind {
+	case KindBool:
+		return ColumnType{Name: "tinyint(1)"}
+	case KindInt:
+		name := map[int]string{8: "tinyint", 16: "smallint", 24: "mediumint", 32: "int", 64: "bigint"}[t.Bits]
+		if name == "" {
+			name = "bigint"
+		}
+		if t.Unsigned {
+			name += " unsigned"
+		}
+		return ColumnType{Name: name}
+	case KindDecimal:
+		if t.Precision == 0 {
+			// PostgreSQL numeric without precision is arbitrary precision
+			return ColumnType{Name: "decimal(65,30)", Note: "unbounded numeric limited to decimal(65,30)", Lossy: true, convert: toText}
+		}
+		return ColumnType{Name: fmt.Sprintf("decimal(%d,%d)", t.Precision, t.Scale), convert: toText}
+	case KindFloat:
+		if t.Bits == 32 {
+			return ColumnType{Name: "float"}
+		}
+		return ColumnType{Name: "double"}
+	case KindDate:
+		return ColumnType{Name: "date"}
+	case KindDateTime:
+		return ColumnType{Name: "datetime(6)"}
+	case KindTimestampTZ:
+		return ColumnType{Name: "datetime(6)", Note: "time zone offset dropped; stored in the connection time zone", Lossy: true}
+	case KindTime:
+		ct := textColumn("time(6)")
+		if strings.Contains(strings.ToLower(t.Raw), "with time zone") {
+			ct.Note, ct.Lossy = "time zone offset dropped", true
+		}
+		return ct
+	case KindYear:
+		return ColumnType{Name: "year"}
+	case KindChar:
+		if t.Length > 0 {
+			return textColumn(fmt.Sprintf("char(%d)", t.Length))
+		}
+		return textColumn("char(1)")
+	case KindVarchar:
+		if t.Length > 0 {
+			return textColumn(fmt.Sprintf("varchar(%d)", t.Length))
+		}
+		return textColumn("longtext")
+	case KindText:
+		return textColumn("longtext")
+	case KindBinary:
+		return ColumnType{Name: "longblob"}
+	case KindJSON:
+		return textColumn("json")
+	case KindEnum:
+		return textColumn(fmt.Sprintf("enum(%s)", sqlStringList(t.Values)))
+	case KindSet:
+		return textColumn(fmt.Sprintf("set(%s)", sqlStringList(t.Values)))
+	case KindUUID:
+		return textColumn("char(36)")
+	case KindBit:
+		return ColumnType{Name: fmt.Sprintf("bit(%d)", t.Bits)}
+	default:
+		return ColumnType{Name: "longtext", Note: fmt.Sprintf("unmapped type %s stored as text", t.Raw), Lossy: true, convert: toText}
+	}
+}
@@ -0,0 +1,18 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+// The primary key must come from information_schema: SHOW KEYS returns a
+// different number of columns per MySQL version, with NULLs for key rows
+func TestMySQLPrimaryKeyQuery(t *testing.T) {
+	got := strings.Join(strings.Fields(mysqlPrimaryKeyQuery), " ")
+	want := "SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE " +
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY' " +
+		"ORDER BY ORDINAL_POSITION"
+	if got != want {
+		t.Errorf("primary key query = %q, want %q", got, want)
+	}
+}
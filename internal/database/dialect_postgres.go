@@ -0,0 +1,357 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// postgresDialect implements Dialect for PostgreSQL. PostgreSQL has no
+// SHOW CREATE TABLE / DESCRIBE / SHOW KEYS, so schema introspection is done
+// with the pg_catalog queries below.
+type postgresDialect struct{}
+
+// postgresTableOID resolves a table in the current schema to its pg_class oid
+const postgresTableOID = `(SELECT c.oid FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relname = ? AND n.nspname = current_schema())`
+
+func (postgresDialect) Name() string { return "postgres" }
+
+// Open connects to the "postgres" maintenance database when no database is
+// given, since PostgreSQL connections always target a database.
+func (postgresDialect) Open(config *types.Database, database string) gorm.Dialector {
+	if database == "" {
+		database = "postgres"
+	}
+	return postgres.Open(buildPostgresDSN(config, database))
+}
+
+func (postgresDialect) QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (postgresDialect) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+
+func (postgresDialect) UpsertClause(keyColumns []string, updateColumns []string) string {
+	return onConflictClause(keyColumns, updateColumns)
+}
+
+// InsertLimits: the wire protocol counts bind parameters in 16 bits and
+// has no statement size limit worth sizing batches by
+func (postgresDialect) InsertLimits(db *gorm.DB) (int, int, error) {
+	return 65535, 0, nil
+}
+
+// CreateDatabaseSQL has no IF NOT EXISTS form in PostgreSQL; CreateDatabase
+// checks pg_database before running it
+func (d postgresDialect) CreateDatabaseSQL(name string) string {
+	return fmt.Sprintf("CREATE DATABASE %s", d.QuoteIdent(name))
+}
+
+// Literal includes the UTC offset in timestamps so timestamptz values keep
+// their instant; plain timestamp columns ignore it
+func (postgresDialect) Literal(v interface{}, binary bool) string {
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	hexLiteral := func(b []byte) string { return `'\x` + hex.EncodeToString(b) + "'::bytea" }
+	return renderLiteral(v, binary, quote, hexLiteral, "2006-01-02 15:04:05.999999-07:00")
+}
+
+// CreateDatabase checks pg_database first as PostgreSQL has no
+// CREATE DATABASE IF NOT EXISTS
+func (d postgresDialect) CreateDatabase(db *gorm.DB, name string) error {
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM pg_database WHERE datname = ?", name).Scan(&count).Error; err != nil {
+		return fmt.Errorf("failed to check archive database %s: %w", name, err)
+	}
+	if count > 0 {
+		log.Printf("Archive database %s already exists", name)
+		return nil
+	}
+
+	createDBSQL := d.CreateDatabaseSQL(name)
+	if err := db.Exec(createDBSQL).Error; err != nil {
+		return fmt.Errorf("failed to create archive database %s: %w", name, err)
+	}
+
+	log.Printf("Archive database %s created", name)
+	return nil
+}
+
+func (postgresDialect) TableExists(db *gorm.DB, tableName string) (bool, error) {
+	var count int64
+	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+
+	if err := db.Raw(query, tableName).Scan(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check if table %s exists: %w", tableName, err)
+	}
+
+	return count > 0, nil
+}
+
+// postgresColumn holds one row of the pg_attribute catalog query
+type postgresColumn struct {
+	Name     string
+	Type     string
+	NotNull  bool
+	Default  *string
+	Identity string
+}
+
+// columns reads column definitions for a table from pg_catalog
+func (postgresDialect) columns(db *gorm.DB, tableName string) ([]postgresColumn, error) {
+	query := `SELECT a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+		pg_get_expr(d.adbin, d.adrelid), a.attidentity::text
+		FROM pg_attribute a
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = ` + postgresTableOID + `
+		AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`
+
+	rows, err := db.Raw(query, tableName).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns for table %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	var columns []postgresColumn
+	for rows.Next() {
+		var col postgresColumn
+		if err := rows.Scan(&col.Name, &col.Type, &col.NotNull, &col.Default, &col.Identity); err != nil {
+			return nil, fmt.Errorf("failed to scan column info: %w", err)
+		}
+		columns = append(columns, col)
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s not found in current schema", tableName)
+	}
+
+	return columns, nil
+}
+
+func (postgresDialect) GetPrimaryKeyColumns(db *gorm.DB, tableName string) ([]string, error) {
+	query := `SELECT a.attname
+		FROM pg_index i
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE i.indrelid = ` + postgresTableOID + ` AND i.indisprimary
+		ORDER BY array_position(i.indkey::int2[], a.attnum)`
+
+	rows, err := db.Raw(query, tableName).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get primary keys for table %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	var primaryKeys []string
+	for rows.Next() {
+		var columnName string
+		if err := rows.Scan(&columnName); err != nil {
+			return nil, fmt.Errorf("failed to scan primary key info: %w", err)
+		}
+		primaryKeys = append(primaryKeys, columnName)
+	}
+
+	return primaryKeys, nil
+}
+
+func (postgresDialect) ForeignKeys(db *gorm.DB) ([]ForeignKey, error) {
+	query := `SELECT c.conname, t.relname, a.attname, rt.relname, ra.attname
+		FROM pg_constraint c
+		JOIN pg_class t ON t.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_class rt ON rt.oid = c.confrelid
+		CROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, refattnum, pos)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		JOIN pg_attribute ra ON ra.attrelid = c.confrelid AND ra.attnum = k.refattnum
+		WHERE c.contype = 'f' AND n.nspname = current_schema()
+		ORDER BY t.relname, c.conname, k.pos`
+	return scanForeignKeys(db, query)
+}
+
+// GetTableSchema synthesizes a CREATE TABLE statement from pg_catalog.
+// Sequence defaults (serial) and identity clauses are dropped: the archive
+// receives explicit key values from the source and must not depend on
+// sequences that only exist in the source database.
+func (d postgresDialect) GetTableSchema(db *gorm.DB, tableName string) (string, error) {
+	columns, err := d.columns(db, tableName)
+	if err != nil {
+		return "", err
+	}
+
+	primaryKeys, err := d.GetPrimaryKeyColumns(db, tableName)
+	if err != nil {
+		return "", err
+	}
+
+	var defs []string
+	for _, col := range columns {
+		def := fmt.Sprintf("%s %s", d.QuoteIdent(col.Name), col.Type)
+		if col.NotNull {
+			def += " NOT NULL"
+		}
+		if col.Default != nil && !strings.HasPrefix(*col.Default, "nextval(") {
+			def += " DEFAULT " + *col.Default
+		}
+		defs = append(defs, def)
+	}
+
+	if len(primaryKeys) > 0 {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", quoteIdentList(d, primaryKeys)))
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", d.QuoteIdent(tableName), strings.Join(defs, ",\n  ")), nil
+}
+
+// GetTableColumns returns column information shaped like MySQL DESCRIBE
+// output so the migration code can treat every engine the same way.
+func (d postgresDialect) GetTableColumns(db *gorm.DB, tableName string) ([]ColumnInfo, error) {
+	columns, err := d.columns(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKeys, err := d.GetPrimaryKeyColumns(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	isPrimary := make(map[string]bool, len(primaryKeys))
+	for _, pk := range primaryKeys {
+		isPrimary[pk] = true
+	}
+
+	var result []ColumnInfo
+	for _, col := range columns {
+		info := ColumnInfo{
+			Field: col.Name,
+			Type:  col.Type,
+			Null:  "YES",
+		}
+		if col.NotNull {
+			info.Null = "NO"
+		}
+		if isPrimary[col.Name] {
+			info.Key = "PRI"
+		}
+		if col.Default != nil {
+			info.Default = *col.Default
+			if strings.HasPrefix(*col.Default, "nextval(") {
+				info.Extra = "auto_increment"
+			}
+		}
+		if col.Identity != "" {
+			info.Extra = "auto_increment"
+		}
+		result = append(result, info)
+	}
+
+	return result, nil
+}
+
+// SnapshotTxOptions uses REPEATABLE READ, whose snapshot is taken at the
+// first statement of the transaction
+func (postgresDialect) SnapshotTxOptions() *sql.TxOptions {
+	return &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+}
+
+// DisableConstraints uses session_replication_role to bypass FK constraints
+// and triggers (requires superuser or replication privileges)
+func (postgresDialect) DisableConstraints(conn sqlExecer) func() {
+	if _, err := conn.Exec("SET session_replication_role = replica"); err != nil {
+		log.Printf("WARNING: Failed to disable PostgreSQL constraints: %v", err)
+	}
+	return func() {
+		if _, err := conn.Exec("SET session_replication_role = origin"); err != nil {
+			log.Printf("WARNING: Failed to re-enable PostgreSQL constraints: %v", err)
+		}
+	}
+}
+
+func (d postgresDialect) ColumnType(column string, t LogicalType) ColumnType {
+	switch t.Kind {
+	case KindBool:
+		return ColumnType{Name: "boolean", convert: toBool}
+	case KindInt:
+		// PostgreSQL has no unsigned or 1/3-byte integers: widen to the next
+		// type that holds the full source range
+		switch {
+		case t.Bits <= 8 || (t.Bits == 16 && !t.Unsigned):
+			return ColumnType{Name: "smallint"}
+		case t.Bits <= 24 || (t.Bits == 32 && !t.Unsigned):
+			ct := ColumnType{Name: "integer"}
+			if t.Unsigned && t.Bits == 16 {
+				ct.Note = "widened: unsigned smallint"
+			}
+			return ct
+		case t.Bits == 32 || !t.Unsigned:
+			ct := ColumnType{Name: "bigint"}
+			if t.Unsigned {
+				ct.Note = "widened: unsigned int"
+			}
+			return ct
+		default:
+			return ColumnType{Name: "numeric(20,0)", Note: "widened: unsigned bigint exceeds bigint range", convert: toDecimalString}
+		}
+	case KindDecimal:
+		if t.Precision > 0 {
+			return ColumnType{Name: fmt.Sprintf("numeric(%d,%d)", t.Precision, t.Scale), convert: toDecimalString}
+		}
+		return ColumnType{Name: "numeric", convert: toDecimalString}
+	case KindFloat:
+		if t.Bits == 32 {
+			return ColumnType{Name: "real"}
+		}
+		return ColumnType{Name: "double precision"}
+	case KindDate:
+		return ColumnType{Name: "date"}
+	case KindDateTime:
+		return ColumnType{Name: "timestamp"}
+	case KindTimestampTZ:
+		return ColumnType{Name: "timestamptz"}
+	case KindTime:
+		return textColumn("time")
+	case KindYear:
+		return ColumnType{Name: "smallint"}
+	case KindChar:
+		if t.Length > 0 {
+			return textColumn(fmt.Sprintf("char(%d)", t.Length))
+		}
+		return textColumn("char")
+	case KindVarchar:
+		if t.Length > 0 {
+			return textColumn(fmt.Sprintf("varchar(%d)", t.Length))
+		}
+		return textColumn("varchar")
+	case KindText:
+		return textColumn("text")
+	case KindBinary:
+		return ColumnType{Name: "bytea"}
+	case KindJSON:
+		return textColumn("jsonb")
+	case KindEnum:
+		ct := textColumn("text")
+		ct.Check = fmt.Sprintf("%s IN (%s)", d.QuoteIdent(column), sqlStringList(t.Values))
+		return ct
+	case KindSet:
+		ct := textColumn("text")
+		ct.Note = "set stored as comma-separated text"
+		return ct
+	case KindUUID:
+		return textColumn("uuid")
+	case KindBit:
+		if t.Bits == 1 {
+			return ColumnType{Name: "boolean", convert: toBool}
+		}
+		return ColumnType{Name: "bigint", Note: "bit field stored as integer", convert: bitsToInt}
+	default:
+		return ColumnType{Name: "text", Note: fmt.Sprintf("unmapped type %s stored as text", t.Raw), Lossy: true, convert: toText}
+	}
+}
@@ -0,0 +1,279 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"data-splitter/pkg/types"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// sqliteDialect implements Dialect for SQLite archive files. The "database"
+// name is the path of the file, as resolved from archive_pattern.
+//
+// The driver (glebarez/sqlite on modernc.org/sqlite) is pure Go, so SQLite
+// archives also work in the CGO_ENABLED=0 release binaries.
+type sqliteDialect struct{}
+
+// sqliteArchiveExtensions are the archive_pattern suffixes that select a
+// SQLite file instead of a database on the server
+var sqliteArchiveExtensions = []string{".sqlite", ".sqlite3", ".db"}
+
+// IsSQLiteArchive reports whether an archive name is a SQLite file path
+func IsSQLiteArchive(archiveName string) bool {
+	ext := strings.ToLower(filepath.Ext(archiveName))
+	for _, candidate := range sqliteArchiveExtensions {
+		if ext == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) Open(config *types.Database, database string) gorm.Dialector {
+	return sqlite.Open(database)
+}
+
+func (sqliteDialect) QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (sqliteDialect) Placeholder(n int) string { return "?" }
+
+func (sqliteDialect) UpsertClause(keyColumns []string, updateColumns []string) string {
+	return onConflictClause(keyColumns, updateColumns)
+}
+
+// InsertLimits uses the SQLITE_MAX_VARIABLE_NUMBER default of SQLite 3.32+
+func (sqliteDialect) InsertLimits(db *gorm.DB) (int, int, error) {
+	return 32766, 0, nil
+}
+
+func (sqliteDialect) CreateDatabaseSQL(name string) string { return "" }
+
+func (sqliteDialect) Literal(v interface{}, binary bool) string {
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+	hexLiteral := func(b []byte) string { return "X'" + hex.EncodeToString(b) + "'" }
+	return renderLiteral(v, binary, quote, hexLiteral, "2006-01-02 15:04:05.999999999-07:00")
+}
+
+// CreateDatabase creates the directory holding the archive file; SQLite
+// creates the file itself on first connect.
+func (sqliteDialect) CreateDatabase(db *gorm.DB, name string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for archive file %s: %w", name, err)
+	}
+
+	log.Printf("Archive directory for %s created or already exists", name)
+	return nil
+}
+
+func (sqliteDialect) TableExists(db *gorm.DB, tableName string) (bool, error) {
+	var count int64
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+
+	if err := db.Raw(query, tableName).Scan(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check if table %s exists: %w", tableName, err)
+	}
+
+	return count > 0, nil
+}
+
+func (sqliteDialect) GetTableSchema(db *gorm.DB, tableName string) (string, error) {
+	var createTableSQL string
+	query := "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?"
+
+	if err := db.Raw(query, tableName).Row().Scan(&createTableSQL); err != nil {
+		return "", fmt.Errorf("failed to get schema for table %s: %w", tableName, err)
+	}
+
+	return createTableSQL, nil
+}
+
+// sqliteColumn holds one row of PRAGMA table_info
+type sqliteColumn struct {
+	Name    string
+	Type    string
+	NotNull bool
+	Default *string
+	PK      int
+}
+
+// columns reads column definitions for a table with PRAGMA table_info
+func (d sqliteDialect) columns(db *gorm.DB, tableName string) ([]sqliteColumn, error) {
+	rows, err := db.Raw(fmt.Sprintf("PRAGMA table_info(%s)", d.QuoteIdent(tableName))).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe table %s: %w", tableName, err)
+	}
+	defer rows.Close()
+
+	var columns []sqliteColumn
+	for rows.Next() {
+		var cid int
+		var col sqliteColumn
+		if err := rows.Scan(&cid, &col.Name, &col.Type, &col.NotNull, &col.Default, &col.PK); err != nil {
+			return nil, fmt.Errorf("failed to scan column info: %w", err)
+		}
+		columns = append(columns, col)
+	}
+
+	return columns, nil
+}
+
+func (d sqliteDialect) GetTableColumns(db *gorm.DB, tableName string) ([]ColumnInfo, error) {
+	columns, err := d.columns(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []ColumnInfo
+	for _, col := range columns {
+		info := ColumnInfo{
+			Field: col.Name,
+			Type:  col.Type,
+			Null:  "YES",
+		}
+		if col.NotNull {
+			info.Null = "NO"
+		}
+		if col.PK > 0 {
+			info.Key = "PRI"
+		}
+		if col.Default != nil {
+			info.Default = *col.Default
+		}
+		result = append(result, info)
+	}
+
+	return result, nil
+}
+
+func (d sqliteDialect) GetPrimaryKeyColumns(db *gorm.DB, tableName string) ([]string, error) {
+	columns, err := d.columns(db, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	// PRAGMA table_info reports the 1-based position within the key in pk
+	byPosition := make(map[int]string)
+	for _, col := range columns {
+		if col.PK > 0 {
+			byPosition[col.PK] = col.Name
+		}
+	}
+
+	var primaryKeys []string
+	for i := 1; i <= len(byPosition); i++ {
+		primaryKeys = append(primaryKeys, byPosition[i])
+	}
+
+	return primaryKeys, nil
+}
+
+// ForeignKeys reads PRAGMA foreign_key_list for every table. A reference
+// without columns points at the parent's primary key.
+func (d sqliteDialect) ForeignKeys(db *gorm.DB) ([]ForeignKey, error) {
+	var tables []string
+	if err := db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name").Scan(&tables).Error; err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	var keys []ForeignKey
+	for _, table := range tables {
+		rows, err := db.Raw(fmt.Sprintf("PRAGMA foreign_key_list(%s)", d.QuoteIdent(table))).Rows()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read foreign keys of table %s: %w", table, err)
+		}
+
+		byID := make(map[int]*ForeignKey)
+		var ids []int
+		for rows.Next() {
+			var id, seq int
+			var parent, from, onUpdate, onDelete, match string
+			var to *string
+			if err := rows.Scan(&id, &seq, &parent, &from, &to, &onUpdate, &onDelete, &match); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan foreign key info: %w", err)
+			}
+			fk, ok := byID[id]
+			if !ok {
+				fk = &ForeignKey{Name: fmt.Sprintf("%s_fk%d", table, id), Table: table, RefTable: parent}
+				byID[id] = fk
+				ids = append(ids, id)
+			}
+			fk.Columns = append(fk.Columns, from)
+			if to != nil {
+				fk.RefColumns = append(fk.RefColumns, *to)
+			}
+		}
+		rows.Close()
+
+		for _, id := range ids {
+			fk := byID[id]
+			if len(fk.RefColumns) == 0 {
+				if fk.RefColumns, err = d.GetPrimaryKeyColumns(db, fk.RefTable); err != nil {
+					return nil, err
+				}
+			}
+			keys = append(keys, *fk)
+		}
+	}
+	return keys, nil
+}
+
+// SnapshotTxOptions returns nil: SQLite is only used as an archive target
+func (sqliteDialect) SnapshotTxOptions() *sql.TxOptions { return nil }
+
+// DisableConstraints turns off foreign key enforcement. SQLite check
+// constraints cannot be bypassed, so invalid data still causes failures.
+func (sqliteDialect) DisableConstraints(conn sqlExecer) func() {
+	if _, err := conn.Exec("PRAGMA foreign_keys = OFF"); err != nil {
+		log.Printf("WARNING: Failed to disable SQLite foreign keys: %v", err)
+	}
+	log.Printf("NOTE: SQLite check constraints cannot be bypassed - invalid data will cause failures")
+	return func() {
+		if _, err := conn.Exec("PRAGMA foreign_keys = ON"); err != nil {
+			log.Printf("WARNING: Failed to re-enable SQLite foreign keys: %v", err)
+		}
+	}
+}
+
+// ColumnType maps to SQLite storage classes. Dates and times are kept as
+// TEXT so the stored value keeps the wall-clock time read from the source.
+func (d sqliteDialect) ColumnType(column string, t LogicalType) ColumnType {
+	switch t.Kind {
+	case KindBool, KindInt, KindYear:
+		ct := ColumnType{Name: "INTEGER"}
+		if t.Kind == KindInt && t.Bits == 64 && t.Unsigned {
+			ct.Note, ct.Lossy = "unsigned bigint above 2^63-1 stored as text", true
+			ct.convert = toDecimalString
+		}
+		return ct
+	case KindBit:
+		return ColumnType{Name: "INTEGER", convert: bitsToInt}
+	case KindDecimal:
+		return textColumn("NUMERIC")
+	case KindFloat:
+		return ColumnType{Name: "REAL"}
+	case KindBinary:
+		return ColumnType{Name: "BLOB"}
+	case KindEnum:
+		ct := textColumn("TEXT")
+		ct.Check = fmt.Sprintf("%s IN (%s)", d.QuoteIdent(column), sqlStringList(t.Values))
+		return ct
+	case KindUnknown:
+		return ColumnType{Name: "TEXT", Note: fmt.Sprintf("unmapped type %s stored as text", t.Raw), convert: toText}
+	default:
+		// char/varchar/text/set/json/uuid and date/time types
+		return textColumn("TEXT")
+	}
+}
@@ -0,0 +1,649 @@
+package database
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-splitter/pkg/types"
+
+	"github.com/klauspost/compress/zstd"
+	"gorm.io/gorm"
+)
+
+// Export archives write the rows of a table/period into compressed part files
+// inside the directory resolved from archive_pattern, described by a
+// manifest. The manifest is written unsealed when the export starts and
+// sealed once every part is closed and checksummed; DeleteMigratedData
+// refuses to run until it is sealed.
+
+// csvNull is written for NULL values in CSV exports (understood by MySQL
+// LOAD DATA and PostgreSQL COPY ... NULL '\N')
+const csvNull = `\N`
+
+// defaultExportPartSizeMB is the part size used when max_file_size_mb is unset
+const defaultExportPartSizeMB = 256
+
+// ExportManifest describes a sealed (or in-progress) set of export files
+type ExportManifest struct {
+	Table       string       `json:"table"`
+	Year        int          `json:"year"`
+	Period      string       `json:"period"` // 2024, 2024-Q1, 2024-01 or 2024-01-15
+	Format      string       `json:"format"`
+	Compression string       `json:"compression"`
+	Columns     []string     `json:"columns"`
+	TotalRows   int64        `json:"total_rows"`
+	Files       []ExportFile `json:"files"`
+	Sealed      bool         `json:"sealed"`
+	SealedAt    *time.Time   `json:"sealed_at,omitempty"`
+	// Upload is set once every file was uploaded and verified (see UploadExport)
+	Upload *ExportUpload `json:"upload,omitempty"`
+}
+
+// ExportFile describes one part file of an export
+type ExportFile struct {
+	Name   string `json:"name"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+	Key    string `json:"key,omitempty"` // object key once uploaded
+}
+
+// ExportDir returns the output directory of a table/period export
+func ExportDir(table *types.Table, period Period) string {
+	return BuildArchiveDBName(table.ArchivePattern, table.Name, period)
+}
+
+// exportBaseName is the file name prefix shared by parts and manifest
+func exportBaseName(table *types.Table, period Period) string {
+	return fmt.Sprintf("%s_%s", table.Name, period)
+}
+
+// ExportManifestPath returns the manifest location of a table/period export.
+// Parquet exports are read by scanning the directory (e.g.
+// table=orders/year=2021/orders_2021.part-0001.parquet), so their manifest
+// starts with "_" to be skipped by readers. Parts and manifest always carry
+// the table and period, so tables or periods sharing a directory never
+// overwrite each other's files.
+func ExportManifestPath(table *types.Table, period Period) string {
+	name := exportBaseName(table, period) + ".manifest.json"
+	if table.Export.Format == "parquet" {
+		name = "_" + name
+	}
+	return filepath.Join(ExportDir(table, period), name)
+}
+
+// checkIdentity fails unless the manifest was written for the table/period
+func (m *ExportManifest) checkIdentity(table *types.Table, period Period) error {
+	if m.Table != table.Name || m.Period != period.String() {
+		return fmt.Errorf("export manifest belongs to table %s period %s, not table %s period %s", m.Table, m.Period, table.Name, period)
+	}
+	return nil
+}
+
+// LoadExportManifest reads the manifest of a table/period export
+func LoadExportManifest(table *types.Table, period Period) (*ExportManifest, error) {
+	path := ExportManifestPath(table, period)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export manifest %s: %w", path, err)
+	}
+
+	var manifest ExportManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse export manifest %s: %w", path, err)
+	}
+
+	return &manifest, nil
+}
+
+// writeExportManifest writes the manifest atomically (temp file + rename) so
+// a crash never leaves a truncated manifest behind
+func writeExportManifest(path string, manifest *ExportManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode export manifest: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write export manifest %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to move export manifest into place %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// ExportTableData streams the rows of a table/period into export files and
+// seals the manifest. When the source has no rows for the period any existing
+// export is left untouched.
+func ExportTableData(sourceDB *gorm.DB, table *types.Table, period Period, config *types.ArchiveOptions) (*ExportManifest, error) {
+	if resumesAt(config.Resume, table, period) {
+		return nil, fmt.Errorf("resume is not supported for file exports; rerun the export from the start")
+	}
+
+	columns, err := GetTableColumns(sourceDB, table.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns for table %s: %w", table.Name, err)
+	}
+
+	sink := newFileSink(table, period, columns)
+	defer sink.abort()
+
+	rows, err := migrateToSink(sourceDB, sink, table, period, columns, nil, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == 0 {
+		log.Printf("No rows exported for table %s, period %s; existing export files (if any) left unchanged", table.Name, period)
+		return nil, nil
+	}
+
+	if err := sink.seal(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Export sealed for table %s, period %s: %d rows in %d file(s), manifest %s",
+		table.Name, period, sink.manifest.TotalRows, len(sink.manifest.Files), sink.manifestPath)
+	return sink.manifest, nil
+}
+
+// ValidateExport checks that the export of a table/period is sealed, that every
+// part file still matches its recorded size and checksum, and that the
+// manifest holds at least as many rows as the source has for the period.
+func ValidateExport(sourceDB *gorm.DB, table *types.Table, period Period) error {
+	manifest, err := LoadExportManifest(table, period)
+	if err != nil {
+		return err
+	}
+
+	if err := manifest.checkIdentity(table, period); err != nil {
+		return err
+	}
+	if !manifest.Sealed {
+		return fmt.Errorf("export for table %s period %s is not sealed", table.Name, period)
+	}
+
+	var fileRows int64
+	for _, file := range manifest.Files {
+		path := filepath.Join(ExportDir(table, period), file.Name)
+		size, sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		if size != file.Bytes || sum != file.SHA256 {
+			return fmt.Errorf("export file %s does not match manifest (size %d/%d, sha256 %s/%s)", path, size, file.Bytes, sum, file.SHA256)
+		}
+		fileRows += file.Rows
+	}
+
+	if fileRows != manifest.TotalRows {
+		return fmt.Errorf("export manifest for table %s period %s is inconsistent: files hold %d rows, total_rows is %d", table.Name, period, fileRows, manifest.TotalRows)
+	}
+
+	sourceCount, err := GetRowCount(sourceDB, table, period)
+	if err != nil {
+		return fmt.Errorf("failed to count source rows: %w", err)
+	}
+
+	if manifest.TotalRows < sourceCount {
+		return fmt.Errorf("export validation failed: source has %d rows, manifest has %d rows (expected at least %d)", sourceCount, manifest.TotalRows, sourceCount)
+	}
+
+	log.Printf("Export validation successful for table %s, period %s: source=%d, manifest=%d rows", table.Name, period, sourceCount, manifest.TotalRows)
+	return nil
+}
+
+// requireSealedExport fails unless the table/period export manifest is sealed
+// and, when an upload is configured, every file was uploaded and verified
+func requireSealedExport(table *types.Table, period Period) error {
+	manifest, err := LoadExportManifest(table, period)
+	if err != nil {
+		return fmt.Errorf("refusing to delete: %w", err)
+	}
+	if err := manifest.checkIdentity(table, period); err != nil {
+		return fmt.Errorf("refusing to delete: %w", err)
+	}
+	if !manifest.Sealed {
+		return fmt.Errorf("refusing to delete: export for table %s period %s is not sealed", table.Name, period)
+	}
+	if table.Export.Upload != nil {
+		if err := manifest.checkUploaded(table.Export.Upload); err != nil {
+			return fmt.Errorf("refusing to delete: %w", err)
+		}
+	}
+	return nil
+}
+
+// hashFile returns the size and hex SHA-256 of a file
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open export file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read export file %s: %w", path, err)
+	}
+
+	return size, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// rowEncoder writes rows in one export format
+type rowEncoder interface {
+	WriteRow(values []interface{}) error
+	Flush() error
+}
+
+// fileSink writes batches into rotating, compressed part files
+type fileSink struct {
+	table        *types.Table
+	export       *types.Export
+	dir          string
+	baseName     string
+	manifestPath string
+	columns      []ColumnInfo
+	kinds        []TypeKind
+	maxBytes     int64
+	manifest     *ExportManifest
+
+	// current part
+	file       *os.File
+	hasher     hash.Hash
+	counter    *countingWriter
+	compressor io.WriteCloser
+	encoder    rowEncoder
+	partRows   int64
+}
+
+func newFileSink(table *types.Table, period Period, columns []ColumnInfo) *fileSink {
+	export := table.Export
+	maxMB := export.MaxFileSizeMB
+	if maxMB <= 0 {
+		maxMB = defaultExportPartSizeMB
+	}
+
+	kinds := make([]TypeKind, len(columns))
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		kinds[i] = ParseColumnType(col.Type).Kind
+		names[i] = col.Field
+	}
+
+	return &fileSink{
+		table:        table,
+		export:       export,
+		dir:          ExportDir(table, period),
+		baseName:     exportBaseName(table, period),
+		manifestPath: ExportManifestPath(table, period),
+		columns:      columns,
+		kinds:        kinds,
+		maxBytes:     int64(maxMB) * 1024 * 1024,
+		manifest: &ExportManifest{
+			Table:       table.Name,
+			Year:        period.Year(),
+			Period:      period.String(),
+			Format:      export.Format,
+			Compression: exportCompression(export),
+			Columns:     names,
+		},
+	}
+}
+
+// exportCompression returns the effective compression (snappy for Parquet,
+// gzip otherwise)
+func exportCompression(export *types.Export) string {
+	if export.Compression != "" {
+		return export.Compression
+	}
+	if export.Format == "parquet" {
+		return "snappy"
+	}
+	return "gzip"
+}
+
+// start prepares the output directory: it records an unsealed manifest and
+// removes part files left by a previous export of the same table/period
+func (s *fileSink) start() error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory %s: %w", s.dir, err)
+	}
+
+	if err := writeExportManifest(s.manifestPath, s.manifest); err != nil {
+		return err
+	}
+
+	stale, err := filepath.Glob(filepath.Join(s.dir, s.partGlob()))
+	if err != nil {
+		return fmt.Errorf("failed to list previous export files: %w", err)
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove previous export file %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// partGlob matches the part files of this table/period
+func (s *fileSink) partGlob() string {
+	return s.baseName + ".part-*"
+}
+
+// partName returns the file name of the n-th (1-based) part
+func (s *fileSink) partName(n int) string {
+	if s.export.Format == "parquet" {
+		return fmt.Sprintf("%s.part-%04d.parquet", s.baseName, n)
+	}
+
+	name := fmt.Sprintf("%s.part-%04d.%s", s.baseName, n, s.export.Format)
+	switch exportCompression(s.export) {
+	case "gzip":
+		name += ".gz"
+	case "zstd":
+		name += ".zst"
+	}
+	return name
+}
+
+// openPart starts a new part file
+func (s *fileSink) openPart() error {
+	if len(s.manifest.Files) == 0 {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+
+	name := s.partName(len(s.manifest.Files) + 1)
+	file, err := os.Create(filepath.Join(s.dir, name))
+	if err != nil {
+		return fmt.Errorf("failed to create export file %s: %w", name, err)
+	}
+
+	s.file = file
+	s.hasher = sha256.New()
+	s.counter = &countingWriter{w: io.MultiWriter(file, s.hasher)}
+	s.partRows = 0
+	s.manifest.Files = append(s.manifest.Files, ExportFile{Name: name})
+
+	switch exportCompression(s.export) {
+	case "gzip":
+		s.compressor = gzip.NewWriter(s.counter)
+	case "snappy":
+		// Parquet compresses pages itself
+		s.compressor = nopWriteCloser{s.counter}
+	case "zstd":
+		encoder, err := zstd.NewWriter(s.counter)
+		if err != nil {
+			return fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		s.compressor = encoder
+	default:
+		s.compressor = nopWriteCloser{s.counter}
+	}
+
+	switch s.export.Format {
+	case "parquet":
+		s.compressor = nopWriteCloser{s.counter}
+		s.encoder, err = newParquetEncoder(s.compressor, s.columns, exportCompression(s.export), s.export.RowGroupSizeMB)
+		if err != nil {
+			return err
+		}
+	case "ndjson":
+		s.encoder = newNDJSONEncoder(s.compressor, s.columns, s.kinds)
+	default:
+		s.encoder, err = newCSVEncoder(s.compressor, s.columns, s.kinds)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Writing export file %s", filepath.Join(s.dir, name))
+	return nil
+}
+
+// closePart flushes, compresses and checksums the current part
+func (s *fileSink) closePart() error {
+	if s.file == nil {
+		return nil
+	}
+
+	if err := s.encoder.Flush(); err != nil {
+		return fmt.Errorf("failed to flush export file: %w", err)
+	}
+	if err := s.compressor.Close(); err != nil {
+		return fmt.Errorf("failed to finish compression: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync export file: %w", err)
+	}
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close export file: %w", err)
+	}
+
+	part := &s.manifest.Files[len(s.manifest.Files)-1]
+	part.Rows = s.partRows
+	part.Bytes = s.counter.n
+	part.SHA256 = hex.EncodeToString(s.hasher.Sum(nil))
+	s.file = nil
+
+	log.Printf("Closed export file %s: %d rows, %d bytes, sha256 %s", part.Name, part.Rows, part.Bytes, part.SHA256)
+	return nil
+}
+
+// emptyTextAsNull: export files replace the deleted rows and keep empty
+// strings as they are
+func (s *fileSink) emptyTextAsNull() bool { return false }
+
+func (s *fileSink) WriteBatch(rows [][]interface{}) (int64, error) {
+	for _, values := range rows {
+		if s.file == nil {
+			if err := s.openPart(); err != nil {
+				return 0, err
+			}
+		}
+
+		if err := s.encoder.WriteRow(values); err != nil {
+			return 0, fmt.Errorf("failed to write export row: %w", err)
+		}
+		s.partRows++
+		s.manifest.TotalRows++
+
+		// Compressed output lags behind buffered input, so parts end up
+		// slightly larger than max_file_size_mb
+		if s.counter.n >= s.maxBytes {
+			if err := s.closePart(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return int64(len(rows)), nil
+}
+
+// seal closes the last part and marks the manifest as complete
+func (s *fileSink) seal() error {
+	if err := s.closePart(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	s.manifest.Sealed = true
+	s.manifest.SealedAt = &now
+	return writeExportManifest(s.manifestPath, s.manifest)
+}
+
+// abort closes an open part after a failure; the manifest stays unsealed
+func (s *fileSink) abort() {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// nopWriteCloser is used for uncompressed exports
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// csvEncoder writes a header row followed by one record per row
+type csvEncoder struct {
+	w     *csv.Writer
+	kinds []TypeKind
+	rec   []string
+}
+
+func newCSVEncoder(w io.Writer, columns []ColumnInfo, kinds []TypeKind) (*csvEncoder, error) {
+	enc := &csvEncoder{w: csv.NewWriter(w), kinds: kinds, rec: make([]string, len(columns))}
+	for i, col := range columns {
+		enc.rec[i] = col.Field
+	}
+	if err := enc.w.Write(enc.rec); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	return enc, nil
+}
+
+func (e *csvEncoder) WriteRow(values []interface{}) error {
+	for i, v := range values {
+		e.rec[i] = formatExportText(v, e.kinds[i])
+	}
+	return e.w.Write(e.rec)
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// formatExportText renders a value for CSV output
+func formatExportText(v interface{}, kind TypeKind) string {
+	switch x := v.(type) {
+	case nil:
+		return csvNull
+	case []byte:
+		if kind == KindBinary {
+			return base64.StdEncoding.EncodeToString(x)
+		}
+		return string(x)
+	case string:
+		return x
+	case time.Time:
+		if kind == KindDate {
+			return x.Format("2006-01-02")
+		}
+		return x.Format("2006-01-02 15:04:05.999999999")
+	case bool:
+		return strconv.FormatBool(x)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// ndjsonEncoder writes one JSON object per line, keeping column order
+type ndjsonEncoder struct {
+	w     *bufio.Writer
+	keys  [][]byte
+	kinds []TypeKind
+}
+
+func newNDJSONEncoder(w io.Writer, columns []ColumnInfo, kinds []TypeKind) *ndjsonEncoder {
+	keys := make([][]byte, len(columns))
+	for i, col := range columns {
+		keys[i], _ = json.Marshal(col.Field)
+	}
+	return &ndjsonEncoder{w: bufio.NewWriter(w), keys: keys, kinds: kinds}
+}
+
+func (e *ndjsonEncoder) WriteRow(values []interface{}) error {
+	e.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		e.w.Write(e.keys[i])
+		e.w.WriteByte(':')
+
+		data, err := json.Marshal(exportJSONValue(v, e.kinds[i]))
+		if err != nil {
+			return fmt.Errorf("failed to encode column %s: %w", e.keys[i], err)
+		}
+		e.w.Write(data)
+	}
+	e.w.WriteByte('}')
+	return e.w.WriteByte('\n')
+}
+
+func (e *ndjsonEncoder) Flush() error { return e.w.Flush() }
+
+// exportJSONValue adapts a scanned value for JSON encoding: text arrives as
+// raw bytes from the MySQL driver, binary columns are base64 encoded and
+// JSON columns are embedded as JSON rather than as a string
+func exportJSONValue(v interface{}, kind TypeKind) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		switch {
+		case kind == KindBinary:
+			return x
+		case kind == KindJSON && json.Valid(x):
+			return json.RawMessage(x)
+		default:
+			return string(x)
+		}
+	case string:
+		if kind == KindJSON && json.Valid([]byte(x)) {
+			return json.RawMessage(x)
+		}
+		return x
+	case time.Time:
+		if kind == KindDate {
+			return x.Format("2006-01-02")
+		}
+		return x
+	default:
+		return v
+	}
+}
+
+// ValidExportFormat reports whether format is a supported export format
+func ValidExportFormat(format string) bool {
+	switch strings.ToLower(format) {
+	case "csv", "ndjson", "parquet":
+		return true
+	}
+	return false
+}
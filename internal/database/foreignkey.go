@@ -0,0 +1,192 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/gorm"
+)
+
+// ForeignKey is a foreign key constraint: Columns of Table reference
+// RefColumns of RefTable
+type ForeignKey struct {
+	Name       string
+	Table      string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+}
+
+func (fk ForeignKey) String() string {
+	return fmt.Sprintf("%s(%s) -> %s(%s)", fk.Table, strings.Join(fk.Columns, ", "), fk.RefTable, strings.Join(fk.RefColumns, ", "))
+}
+
+// ForeignKeys returns the foreign keys declared in the connected database
+func ForeignKeys(db *gorm.DB) ([]ForeignKey, error) {
+	return DialectOf(db).ForeignKeys(db)
+}
+
+// scanForeignKeys reads (constraint, table, column, referenced table,
+// referenced column) rows ordered by table, constraint and column position
+func scanForeignKeys(db *gorm.DB, query string) ([]ForeignKey, error) {
+	rows, err := db.Raw(query).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []ForeignKey
+	for rows.Next() {
+		var name, table, column, refTable, refColumn string
+		if err := rows.Scan(&name, &table, &column, &refTable, &refColumn); err != nil {
+			return nil, fmt.Errorf("failed to scan foreign key info: %w", err)
+		}
+		if n := len(keys); n > 0 && keys[n-1].Name == name && keys[n-1].Table == table {
+			keys[n-1].Columns = append(keys[n-1].Columns, column)
+			keys[n-1].RefColumns = append(keys[n-1].RefColumns, refColumn)
+			continue
+		}
+		keys = append(keys, ForeignKey{Name: name, Table: table, Columns: []string{column}, RefTable: refTable, RefColumns: []string{refColumn}})
+	}
+	return keys, nil
+}
+
+// CascadeTables resolves the children of a table (recursively) into tables
+// whose rows are selected through their parent. The result lists every
+// child before its parent and ends with the table itself: copies and deletes
+// run in this order, so child rows are archived before and removed before
+// the parent rows they reference.
+func CascadeTables(db *gorm.DB, table *types.Table) ([]*types.Table, error) {
+	var keys []ForeignKey
+	var family []*types.Table
+	seen := map[string]bool{table.Name: true}
+
+	var add func(parent *types.Table, children types.Children) error
+	add = func(parent *types.Table, children types.Children) error {
+		list := children.List
+		if children.Auto {
+			if keys == nil {
+				var err error
+				if keys, err = ForeignKeys(db); err != nil {
+					return err
+				}
+			}
+			var err error
+			if list, err = referencingChildren(keys, parent.Name); err != nil {
+				return err
+			}
+		}
+
+		for _, child := range list {
+			if seen[child.Name] {
+				log.Printf("Skipping child %s of table %s: it is already archived through another table", child.Name, parent.Name)
+				continue
+			}
+			seen[child.Name] = true
+
+			derived, err := childTable(db, parent, child)
+			if err != nil {
+				return err
+			}
+			if err := add(derived, child.Children); err != nil {
+				return err
+			}
+			family = append(family, derived)
+		}
+		return nil
+	}
+
+	if err := add(table, table.Children); err != nil {
+		return nil, fmt.Errorf("failed to resolve children of table %s: %w", table.Name, err)
+	}
+	return append(family, table), nil
+}
+
+// CheckFamilies rejects resolved families (each an enabled table followed by
+// its children, explicit or discovered with children: auto) that archive a
+// table twice: a child that is also an enabled table, or a child of two
+// tables, would be copied and deleted along two paths
+func CheckFamilies(families [][]string) error {
+	owner := make(map[string]string)
+	for _, names := range families {
+		owner[names[0]] = names[0]
+	}
+	for _, names := range families {
+		for _, child := range names[1:] {
+			switch other, ok := owner[child]; {
+			case !ok:
+				owner[child] = names[0]
+			case other == child:
+				return fmt.Errorf("%s is a child of table %s and also an enabled table; archive it either as a child or on its own", child, names[0])
+			default:
+				return fmt.Errorf("%s is a child of both %s and %s; list it under one of them only", child, other, names[0])
+			}
+		}
+	}
+	return nil
+}
+
+// referencingChildren turns the foreign keys referencing a table into
+// children, each discovering its own children in turn
+func referencingChildren(keys []ForeignKey, parent string) ([]types.Child, error) {
+	var children []types.Child
+	for _, fk := range keys {
+		if fk.RefTable != parent {
+			continue
+		}
+		if fk.Table == parent {
+			log.Printf("Ignoring self-referencing foreign key %s", fk)
+			continue
+		}
+		if len(fk.Columns) != 1 {
+			return nil, fmt.Errorf("composite foreign key %s is not supported; list the children explicitly", fk)
+		}
+		children = append(children, types.Child{
+			Name:      fk.Table,
+			Key:       fk.Columns[0],
+			ParentKey: fk.RefColumns[0],
+			Children:  types.Children{Auto: true},
+		})
+	}
+	return children, nil
+}
+
+// defaultParentKey returns the single-column primary key of a parent table,
+// the column referenced by a child (or split_via) without parent_key
+func defaultParentKey(db *gorm.DB, parent string, child string) (string, error) {
+	keys, err := GetPrimaryKeyColumns(db, parent)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) != 1 {
+		return "", fmt.Errorf("%s needs parent_key: table %s has no single-column primary key", child, parent)
+	}
+	return keys[0], nil
+}
+
+// childTable derives the table archived for a child: it shares the archive
+// settings of its parent and selects its rows through the parent
+func childTable(db *gorm.DB, parent *types.Table, child types.Child) (*types.Table, error) {
+	parentKey := child.ParentKey
+	if parentKey == "" {
+		var err error
+		if parentKey, err = defaultParentKey(db, parent.Name, "child "+child.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return &types.Table{
+		Name:            child.Name,
+		Enabled:         true,
+		ArchivePattern:  parent.ArchivePattern,
+		Granularity:     parent.Granularity,
+		FiscalYearStart: parent.FiscalYearStart,
+		ArchiveDatabase: parent.ArchiveDatabase,
+		Export:          parent.Export,
+		TimeZone:        parent.TimeZone,
+		Parent:          &types.ParentLink{Parent: parent, Key: child.Key, ParentKey: parentKey},
+	}, nil
+}
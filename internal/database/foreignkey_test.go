@@ -0,0 +1,28 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckFamilies(t *testing.T) {
+	tests := []struct {
+		families [][]string
+		wantErr  string
+	}{
+		{[][]string{{"orders", "order_items"}, {"invoices", "invoice_lines"}}, ""},
+		{[][]string{{"orders", "order_items"}, {"order_items"}}, "also an enabled table"},
+		{[][]string{{"order_items"}, {"orders", "order_items"}}, "also an enabled table"},
+		{[][]string{{"orders", "notes"}, {"invoices", "notes"}}, "child of both orders and invoices"},
+	}
+
+	for _, tt := range tests {
+		err := CheckFamilies(tt.families)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("CheckFamilies(%v): %v", tt.families, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("CheckFamilies(%v) error = %v, want %q", tt.families, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/gorm"
+)
+
+// Tables of a group (tables[].group) are processed with one cutoff instant
+// taken when the group starts: periods reaching past it end at the cutoff,
+// so every table stops at the same row, and the source is read through one
+// snapshot so rows inserted while the group runs are seen by none of them.
+
+// BeginSnapshot starts a read-only transaction on db whose reads all see
+// the data as of now, pinning the snapshot with a first read from table.
+// It returns nil (and reads go to db as usual) when the engine has no
+// snapshot isolation.
+func BeginSnapshot(db *gorm.DB, table string) (*gorm.DB, error) {
+	dialect := DialectOf(db)
+	options := dialect.SnapshotTxOptions()
+	if options == nil {
+		log.Printf("No consistent snapshot for %s sources; tables of the group are read separately", dialect.Name())
+		return nil, nil
+	}
+
+	tx := db.Begin(options)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to begin snapshot transaction: %w", tx.Error)
+	}
+
+	// The snapshot is taken at the first read, not at BEGIN
+	var pinned []int
+	if err := tx.Raw(fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", dialect.QuoteIdent(table))).Scan(&pinned).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to take snapshot: %w", err)
+	}
+	return tx, nil
+}
+
+// ClampPeriod ends a period at cutoff (an instant, compared in the table's
+// time zone) when the cutoff falls inside it
+func ClampPeriod(table *types.Table, period Period, cutoff time.Time) (Period, error) {
+	loc, err := LoadTimeZone(table.TimeZone)
+	if err != nil {
+		return period, err
+	}
+
+	end := wallClock(cutoff.In(loc))
+	if !end.Before(period.End) {
+		return period, nil
+	}
+	if end.Before(period.Start) {
+		end = period.Start
+	}
+	period.End = end
+	return period, nil
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// keyCursor pages through the rows of a period in primary key order:
+// every batch selects "WHERE key > last ORDER BY key LIMIT n", so pages are
+// stable and each batch costs the same however far the migration got.
+// Tables without a primary key fall back to LIMIT/OFFSET paging.
+type keyCursor struct {
+	dialect   Dialect
+	columns   []string      // key column names in key order
+	positions []int         // index of each key column in the selected columns
+	last      []interface{} // key of the last stored row (nil before the first batch)
+	offset    int           // rows read so far (OFFSET fallback only)
+}
+
+// newKeyCursor builds the cursor for a table from its primary key; columns
+// are the selected columns of the batch query
+func newKeyCursor(db *gorm.DB, tableName string, columns []ColumnInfo) (*keyCursor, error) {
+	keys, err := GetPrimaryKeyColumns(db, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get primary key of table %s: %w", tableName, err)
+	}
+
+	cursor := &keyCursor{dialect: DialectOf(db)}
+	for _, key := range keys {
+		position := -1
+		for i, col := range columns {
+			if strings.EqualFold(col.Field, key) {
+				position = i
+				break
+			}
+		}
+		if position < 0 {
+			return nil, fmt.Errorf("primary key column %s of table %s is not among the migrated columns", key, tableName)
+		}
+		cursor.columns = append(cursor.columns, key)
+		cursor.positions = append(cursor.positions, position)
+	}
+
+	if len(cursor.columns) == 0 {
+		log.Printf("WARNING: table %s has no primary key; falling back to LIMIT/OFFSET paging without a stable order", tableName)
+	}
+	return cursor, nil
+}
+
+// resume positions the cursor after the given key values
+func (c *keyCursor) resume(key []string) error {
+	if len(c.columns) == 0 {
+		return fmt.Errorf("resuming needs a primary key")
+	}
+	if len(key) != len(c.columns) {
+		return fmt.Errorf("resume key has %d values but the primary key (%s) has %d columns", len(key), strings.Join(c.columns, ", "), len(c.columns))
+	}
+
+	c.last = make([]interface{}, len(key))
+	for i, value := range key {
+		c.last[i] = primaryKeyArg(value)
+	}
+	return nil
+}
+
+// condition returns the keyset condition selecting the rows after the
+// cursor. Composite keys are expanded to
+// (k1 > ?) OR (k1 = ? AND k2 > ?) OR ..., which every engine can serve from
+// the primary key index.
+func (c *keyCursor) condition() (string, []interface{}) {
+	if c.last == nil {
+		return "", nil
+	}
+
+	var alternatives []string
+	var args []interface{}
+	for i := range c.columns {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, c.dialect.QuoteIdent(c.columns[j])+" = ?")
+			args = append(args, c.last[j])
+		}
+		parts = append(parts, c.dialect.QuoteIdent(c.columns[i])+" > ?")
+		args = append(args, c.last[i])
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	if len(alternatives) == 1 {
+		return alternatives[0], args
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// page returns the ORDER BY / LIMIT clause of the next batch
+func (c *keyCursor) page(batchSize int) string {
+	if len(c.columns) == 0 {
+		return fmt.Sprintf("LIMIT %d OFFSET %d", batchSize, c.offset)
+	}
+
+	quoted := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		quoted[i] = c.dialect.QuoteIdent(col)
+	}
+	return fmt.Sprintf("ORDER BY %s LIMIT %d", strings.Join(quoted, ", "), batchSize)
+}
+
+// keyOf copies the key values out of a scanned row
+func (c *keyCursor) keyOf(row []interface{}) []interface{} {
+	key := make([]interface{}, len(c.positions))
+	for i, position := range c.positions {
+		value := row[position]
+		// Drivers may reuse []byte buffers; keep a copy
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		key[i] = value
+	}
+	return key
+}
+
+// advance moves the cursor past a stored batch of n rows ending at key
+func (c *keyCursor) advance(key []interface{}, n int) {
+	if len(c.columns) == 0 {
+		c.offset += n
+		return
+	}
+	c.last = key
+}
+
+// describe names the paging order for logs
+func (c *keyCursor) describe() string {
+	if len(c.columns) == 0 {
+		return "offset (no primary key)"
+	}
+	return "primary key (" + strings.Join(c.columns, ", ") + ")"
+}
+
+// String renders the cursor position for logs
+func (c *keyCursor) String() string {
+	if len(c.columns) == 0 {
+		return fmt.Sprintf("offset %d", c.offset)
+	}
+	if c.last == nil {
+		return "start"
+	}
+	values := make([]string, len(c.last))
+	for i, v := range c.last {
+		values[i] = fmt.Sprint(v)
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+// resumeHint renders the cursor position as a resume key config value
+func (c *keyCursor) resumeHint() string {
+	if len(c.columns) == 0 || c.last == nil {
+		return "[]"
+	}
+	values := make([]string, len(c.last))
+	for i, v := range c.last {
+		values[i] = fmt.Sprintf("%q", fmt.Sprint(v))
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"data-splitter/pkg/types"
+)
+
+func TestKeyCursorCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		dialect  Dialect
+		columns  []string
+		last     []interface{}
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:    "first batch",
+			dialect: mysqlDialect{},
+			columns: []string{"id"},
+		},
+		{
+			name:     "single column",
+			dialect:  mysqlDialect{},
+			columns:  []string{"id"},
+			last:     []interface{}{int64(1042)},
+			wantSQL:  "(`id` > ?)",
+			wantArgs: []interface{}{int64(1042)},
+		},
+		{
+			name:     "two columns",
+			dialect:  postgresDialect{},
+			columns:  []string{"order_id", "line"},
+			last:     []interface{}{int64(7), int64(3)},
+			wantSQL:  `(("order_id" > ?) OR ("order_id" = ? AND "line" > ?))`,
+			wantArgs: []interface{}{int64(7), int64(7), int64(3)},
+		},
+		{
+			name:     "three columns",
+			dialect:  mysqlDialect{},
+			columns:  []string{"a", "b", "c"},
+			last:     []interface{}{"x", int64(2), "z"},
+			wantSQL:  "((`a` > ?) OR (`a` = ? AND `b` > ?) OR (`a` = ? AND `b` = ? AND `c` > ?))",
+			wantArgs: []interface{}{"x", "x", int64(2), "x", int64(2), "z"},
+		},
+	}
+
+	for _, tt := range tests {
+		cursor := &keyCursor{dialect: tt.dialect, columns: tt.columns, last: tt.last}
+		sql, args := cursor.condition()
+		if sql != tt.wantSQL {
+			t.Errorf("%s: condition = %q, want %q", tt.name, sql, tt.wantSQL)
+		}
+		if !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("%s: args = %#v, want %#v", tt.name, args, tt.wantArgs)
+		}
+	}
+}
+
+func TestKeyCursorResume(t *testing.T) {
+	cursor := &keyCursor{dialect: mysqlDialect{}, columns: []string{"order_id", "code"}, positions: []int{0, 1}}
+	if err := cursor.resume([]string{"1042"}); err == nil {
+		t.Error("resume with too few values: want an error")
+	}
+	if err := cursor.resume([]string{"1042", "A-7"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{int64(1042), "A-7"}; !reflect.DeepEqual(cursor.last, want) {
+		t.Errorf("last = %#v, want %#v", cursor.last, want)
+	}
+	if got, want := cursor.resumeHint(), `["1042", "A-7"]`; got != want {
+		t.Errorf("resumeHint = %s, want %s", got, want)
+	}
+
+	noKey := &keyCursor{dialect: mysqlDialect{}}
+	if err := noKey.resume([]string{"1"}); err == nil {
+		t.Error("resume without a primary key: want an error")
+	}
+}
+
+func TestKeyCursorPaging(t *testing.T) {
+	cursor := &keyCursor{dialect: mysqlDialect{}, columns: []string{"a", "b"}, positions: []int{2, 0}}
+	if got, want := cursor.page(500), "ORDER BY `a`, `b` LIMIT 500"; got != want {
+		t.Errorf("page = %q, want %q", got, want)
+	}
+
+	key := cursor.keyOf([]interface{}{[]byte("b1"), "x", int64(9)})
+	if want := []interface{}{int64(9), "b1"}; !reflect.DeepEqual(key, want) {
+		t.Errorf("keyOf = %#v, want %#v", key, want)
+	}
+	cursor.advance(key, 500)
+	if got, want := cursor.String(), "(9, b1)"; got != want {
+		t.Errorf("String = %s, want %s", got, want)
+	}
+
+	offset := &keyCursor{dialect: mysqlDialect{}}
+	offset.advance(nil, 500)
+	offset.advance(nil, 500)
+	if got, want := offset.page(500), "LIMIT 500 OFFSET 1000"; got != want {
+		t.Errorf("offset page = %q, want %q", got, want)
+	}
+}
+
+func TestResumesAt(t *testing.T) {
+	resume := &types.Resume{Table: "orders", Period: "2024", Key: []string{"1042"}}
+	orders := &types.Table{Name: "orders"}
+	items := &types.Table{Name: "order_items"}
+
+	tests := []struct {
+		resume *types.Resume
+		table  *types.Table
+		period Period
+		want   bool
+	}{
+		{resume, orders, YearPeriod(2024), true},
+		{resume, orders, YearPeriod(2023), false},
+		{resume, items, YearPeriod(2024), false},
+		{nil, orders, YearPeriod(2024), false},
+	}
+	for _, tt := range tests {
+		if got := resumesAt(tt.resume, tt.table, tt.period); got != tt.want {
+			t.Errorf("resumesAt(%v, %s, %s) = %t, want %t", tt.resume, tt.table.Name, tt.period, got, tt.want)
+		}
+	}
+}
@@ -1,11 +1,11 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
-	"strings"
 	"time"
 
 	"data-splitter/pkg/types"
@@ -16,32 +16,64 @@ import (
 	gormlogger "gorm.io/gorm/logger"
 )
 
-// MigrateTableData migrates data from source table to archive table for a specific year
-func MigrateTableData(sourceDB *gorm.DB, archiveDB *gorm.DB, table *types.Table, year int, config *types.ArchiveOptions) error {
-	startTime := time.Now()
-	log.Printf("Starting data migration for table %s, year %d", table.Name, year)
-
-	// Emit an initial one-line PROGRESS message so pipelines can detect start
-	fmt.Printf("PROGRESS table=%s year=%d processed=%d total=%d batch=%d status=started\n", table.Name, year, 0, 0, 0)
-
+// MigrateTableData migrates data from source table to archive table for a period
+func MigrateTableData(sourceDB *gorm.DB, archiveDB *gorm.DB, table *types.Table, period Period, config *types.ArchiveOptions) error {
 	// Get table columns
 	columns, err := GetTableColumns(sourceDB, table.Name)
 	if err != nil {
 		return fmt.Errorf("failed to get columns for table %s: %w", table.Name, err)
 	}
 
+	// Cross-engine archives need scanned values converted to the archive types
+	var mapping *TableMapping
+	if DialectOf(sourceDB).Name() != DialectOf(archiveDB).Name() {
+		mapping, err = BuildTableMapping(sourceDB, DialectOf(archiveDB), table.Name)
+		if err != nil {
+			return fmt.Errorf("failed to build type mapping for table %s: %w", table.Name, err)
+		}
+	}
+
+	// Build merge insert (handles existing data)
+	insert, err := BuildMergeInsert(DialectOf(archiveDB), table.Name, columns)
+	if err != nil {
+		return fmt.Errorf("failed to build merge insert query: %w", err)
+	}
+
+	sink := &databaseSink{db: archiveDB, insert: insert, mapping: mapping, bypassConstraints: true, nullifyEmptyText: true}
+	_, err = migrateToSink(sourceDB, sink, table, period, columns, nil, config)
+	return err
+}
+
+// migrateToSink runs the batch loop shared by every archive destination:
+// it selects the rows of the period (narrowed by filter, if any) from the
+// source in batches, hands each batch to the sink and reports progress. It
+// returns the number of rows written (including rows before a resume key).
+func migrateToSink(sourceDB *gorm.DB, sink archiveSink, table *types.Table, period Period, columns []ColumnInfo, filter *rowFilter, config *types.ArchiveOptions) (int64, error) {
+	startTime := time.Now()
+	log.Printf("Starting data migration for table %s, period %s", table.Name, period)
+
+	// Emit an initial one-line PROGRESS message so pipelines can detect start
+	fmt.Printf("PROGRESS table=%s %s processed=%d total=%d batch=%d status=started\n", table.Name, PeriodKeys(period), 0, 0, 0)
+
 	// Get total row count
-	totalRows, err := GetRowCount(sourceDB, table.Name, table.SplitColumn, year)
+	totalRows, err := countRows(sourceDB, table, period, filter)
 	if err != nil {
-		return fmt.Errorf("failed to get row count for table %s: %w", table.Name, err)
+		return 0, fmt.Errorf("failed to get row count for table %s: %w", table.Name, err)
 	}
 
 	if totalRows == 0 {
-		log.Printf("No data found for table %s, year %d", table.Name, year)
-		return nil
+		log.Printf("No data found for table %s, period %s", table.Name, period)
+		return 0, nil
 	}
 
-	log.Printf("Migrating %d rows for table %s, year %d", totalRows, table.Name, year)
+	log.Printf("Migrating %d rows for table %s, period %s", totalRows, table.Name, period)
+
+	// The WHERE condition of every batch (period range plus filter)
+	condition, args, err := periodCondition(sourceDB, table, period, filter)
+	if err != nil {
+		return 0, err
+	}
+	where := &rowFilter{sql: condition, args: args}
 
 	// Setup interactive progress UI (progress bar + optional spinner)
 	var sp *spinner.Spinner
@@ -72,49 +104,58 @@ func MigrateTableData(sourceDB *gorm.DB, archiveDB *gorm.DB, table *types.Table,
 		defer sp.Stop()
 	}
 
-	// Build merge insert query (handles existing data)
-	insertQuery, err := BuildMergeInsertQuery(table.Name, columns)
+	// Process data in batches, paging by primary key
+	cursor, err := newKeyCursor(sourceDB, table.Name, columns)
 	if err != nil {
-		return fmt.Errorf("failed to build merge insert query: %w", err)
+		return 0, err
 	}
+	migratedRows := int64(0)
+	if resume := config.Resume; resumesAt(resume, table, period) {
+		if err := cursor.resume(resume.Key); err != nil {
+			return 0, FatalMigrationError{Err: fmt.Errorf("invalid resume key for table %s period %s: %w", table.Name, period, err)}
+		}
 
-	// Process data in batches
-	offset := config.ResumeOffset
-	if offset > 0 {
-		log.Printf("Resuming migration from offset %d for table %s, year %d", offset, table.Name, year)
+		// Rows up to the resume key count as already migrated
+		keyCondition, keyArgs := cursor.condition()
+		remaining, err := countRows(sourceDB, table, period, filter.and(keyCondition, keyArgs))
+		if err != nil {
+			return 0, fmt.Errorf("failed to get row count for table %s: %w", table.Name, err)
+		}
+		migratedRows = totalRows - remaining
+		log.Printf("Resuming migration after key %s for table %s, period %s (%d rows already migrated)", cursor, table.Name, period, migratedRows)
 	}
-	migratedRows := int64(offset)           // Start counting from resume offset
-	batchCount := offset / config.BatchSize // Calculate starting batch number
+	batchCount := 0
+	failedRows := int64(0)
 
-	log.Printf("Starting batch processing for table %s, year %d: %d total rows, batch size %d, starting from offset %d", table.Name, year, totalRows, config.BatchSize, offset)
+	log.Printf("Starting batch processing for table %s, period %s: %d total rows, batch size %d, ordered by %s", table.Name, period, totalRows, config.BatchSize, cursor.describe())
 
-	for offset < int(totalRows) {
+	for {
 		batchCount++
-		batchSize := config.BatchSize
-		if offset+batchSize > int(totalRows) {
-			batchSize = int(totalRows) - offset
-		}
-
-		log.Printf("Processing batch %d: offset %d, size %d for table %s, year %d", batchCount, offset, batchSize, table.Name, year)
+		log.Printf("Processing batch %d after key %s for table %s, period %s", batchCount, cursor, table.Name, period)
 
 		// Migrate batch
-		rowsAffected, err := migrateBatch(sourceDB, archiveDB, table, year, columns, insertQuery, batchSize, offset)
+		rowsRead, rowsAffected, err := migrateBatch(sourceDB, sink, table, period, columns, where, cursor, config.BatchSize)
 		if err != nil {
-			log.Printf("ERROR: Failed to migrate batch %d at offset %d: %v", batchCount, offset, err)
+			log.Printf("ERROR: Failed to migrate batch %d after key %s: %v", batchCount, cursor, err)
 			// Print recent logs to stderr for pipeline visibility
 			PrintRecentLogTail(200)
-			return FatalMigrationError{Err: fmt.Errorf("failed to migrate batch at offset %d: %w", offset, err)}
+			return migratedRows, FatalMigrationError{Err: fmt.Errorf("failed to migrate batch after key %s (resume with resume: {table: %s, period: %q, key: %s}): %w", cursor, table.Name, period, cursor.resumeHint(), err)}
 		}
 
 		migratedRows += rowsAffected
-		offset += batchSize
+		failedRows += int64(rowsRead) - rowsAffected
 
 		// Update UI (spinner suffix only; progress bar removed)
 		if sp != nil {
 			sp.Suffix = fmt.Sprintf(" Loading %s - %d/%d (batch %d)", table.Name, migratedRows, totalRows, batchCount)
 		}
 
-		log.Printf("Completed batch %d: migrated %d/%d rows for table %s, year %d", batchCount, migratedRows, totalRows, table.Name, year)
+		log.Printf("Completed batch %d: migrated %d/%d rows for table %s, period %s (last key %s)", batchCount, migratedRows, totalRows, table.Name, period, cursor)
+
+		// A short batch means the period is exhausted
+		if rowsRead < config.BatchSize {
+			break
+		}
 
 		// Determine heartbeat interval (configured via archive options; default 10)
 		heartbeatInterval := config.HeartbeatBatchInterval
@@ -125,27 +166,39 @@ func MigrateTableData(sourceDB *gorm.DB, archiveDB *gorm.DB, table *types.Table,
 		// Heartbeat every N batches
 		if batchCount%heartbeatInterval == 0 {
 			// Log heartbeat to log file
-			log.Printf("HEARTBEAT: Processed %d batches, %d/%d rows for table %s, year %d", batchCount, migratedRows, totalRows, table.Name, year)
+			log.Printf("HEARTBEAT: Processed %d batches, %d/%d rows for table %s, period %s, last key %s", batchCount, migratedRows, totalRows, table.Name, period, cursor)
 			// Also emit a stable one-line progress message to stdout so pipelines
 			// that capture stdout can read progress without dealing with ANSI
 			// or carriage returns.
-			fmt.Printf("PROGRESS table=%s year=%d processed=%d total=%d batch=%d\n",
-				table.Name, year, migratedRows, totalRows, batchCount)
+			fmt.Printf("PROGRESS table=%s %s processed=%d total=%d batch=%d\n",
+				table.Name, PeriodKeys(period), migratedRows, totalRows, batchCount)
 		}
 	}
 
 	// progress bar removed; spinner will be stopped by defer
 
 	duration := time.Since(startTime)
-	log.Printf("Completed data migration for table %s, year %d: %d rows migrated (duration=%s)", table.Name, year, migratedRows, duration)
+	log.Printf("Completed data migration for table %s, period %s: %d rows migrated, %d failed (duration=%s)", table.Name, period, migratedRows, failedRows, duration)
+
+	// Rows that failed to insert are reported on both lines; the count check
+	// then refuses the period
+	failed := ""
+	if failedRows > 0 {
+		failed = fmt.Sprintf(" failed=%d", failedRows)
+	}
 
 	// Emit a final progress line and a FINAL summary so pipelines can detect completion
-	fmt.Printf("PROGRESS table=%s year=%d processed=%d total=%d batch=%d status=completed duration=%s\n",
-		table.Name, year, migratedRows, totalRows, batchCount, duration)
-	// Also emit a concise FINAL line (machine-friendly)
-	fmt.Printf("FINAL table=%s year=%d processed=%d duration=%s exit=0\n", table.Name, year, migratedRows, duration)
+	fmt.Printf("PROGRESS table=%s %s processed=%d total=%d batch=%d%s status=completed duration=%s\n",
+		table.Name, PeriodKeys(period), migratedRows, totalRows, batchCount, failed, duration)
+	// Also emit a concise FINAL line (machine-friendly); periods archived
+	// with --allow-open-period are flagged
+	openPeriod := ""
+	if config.AllowOpenPeriod && CheckPeriodClosed(table, period.whole(), config.GracePeriod, time.Now()) != nil {
+		openPeriod = " open_period=true"
+	}
+	fmt.Printf("FINAL table=%s %s processed=%d%s duration=%s%s exit=0\n", table.Name, PeriodKeys(period), migratedRows, failed, duration, openPeriod)
 
-	return nil
+	return migratedRows, nil
 }
 
 // FatalMigrationError marks an error as fatal such that the caller should exit
@@ -158,28 +211,34 @@ type FatalMigrationError struct {
 func (e FatalMigrationError) Error() string { return e.Err.Error() }
 func (e FatalMigrationError) Unwrap() error { return e.Err }
 
-// migrateBatch migrates a single batch of data
-func migrateBatch(sourceDB *gorm.DB, archiveDB *gorm.DB, table *types.Table, year int, columns []ColumnInfo, insertQuery string, batchSize int, offset int) (int64, error) {
-	log.Printf("DEBUG: Starting migrateBatch - table: %s, year: %d, batchSize: %d, offset: %d", table.Name, year, batchSize, offset)
+// migrateBatch migrates the batch following the cursor position; where is
+// the complete WHERE condition of the period (see periodCondition). It
+// returns how many rows were read and how many the sink accepted.
+func migrateBatch(sourceDB *gorm.DB, sink archiveSink, table *types.Table, period Period, columns []ColumnInfo, where *rowFilter, cursor *keyCursor, batchSize int) (int, int64, error) {
+	log.Printf("DEBUG: Starting migrateBatch - table: %s, period: %s, batchSize: %d, after: %s", table.Name, period, batchSize, cursor)
 
 	// Build select query with NULLIF transformation for text columns
-	selectQuery := BuildSelectQueryWithColumns(table.Name, table.SplitColumn, year, batchSize, offset, columns)
-	log.Printf("DEBUG: Select query: %s", selectQuery)
+	dialect := DialectOf(sourceDB)
+	page := where.and(cursor.condition())
+	condition, args := page.sql, page.args
+	selectQuery := fmt.Sprintf("SELECT %s FROM %s WHERE %s %s",
+		selectColumnList(dialect, columns, sink.emptyTextAsNull()), dialect.QuoteIdent(table.Name), condition, cursor.page(batchSize))
+	log.Printf("DEBUG: Select query: %s (args: %v)", selectQuery, args)
 
 	// Execute select query
 	log.Printf("DEBUG: Executing select query...")
-	rows, err := sourceDB.Raw(selectQuery).Rows()
+	rows, err := sourceDB.Raw(selectQuery, args...).Rows()
 	if err != nil {
 		log.Printf("ERROR: Failed to execute select query: %v", err)
 		// print recent logs for pipeline visibility
 		PrintRecentLogTail(200)
-		return 0, fmt.Errorf("failed to execute select query: %w", err)
+		return 0, 0, fmt.Errorf("failed to execute select query: %w", err)
 	}
 	defer rows.Close()
 
 	log.Printf("DEBUG: Select query completed, processing rows...")
 
-	// Prepare values for batch insert
+	// Prepare values for the sink
 	var batchValues [][]interface{}
 	var rowCount int64
 
@@ -197,99 +256,154 @@ func migrateBatch(sourceDB *gorm.DB, archiveDB *gorm.DB, table *types.Table, yea
 			log.Printf("ERROR: Failed to scan row: %v", err)
 			// print recent logs for pipeline visibility
 			PrintRecentLogTail(200)
-			return 0, fmt.Errorf("failed to scan row: %w", err)
+			return 0, 0, fmt.Errorf("failed to scan row: %w", err)
 		}
 
 		batchValues = append(batchValues, values)
 		rowCount++
 	}
 
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to read rows: %w", err)
+	}
+
 	log.Printf("DEBUG: Processed %d rows from select query", rowCount)
 
 	if rowCount == 0 {
 		log.Printf("DEBUG: No rows to process, returning")
-		return 0, nil
+		return 0, 0, nil
+	}
+
+	// Take the key of the last row before the sink converts values; the
+	// cursor only moves once the batch is stored
+	lastKey := cursor.keyOf(batchValues[len(batchValues)-1])
+
+	written, err := sink.WriteBatch(batchValues)
+	if err != nil {
+		return 0, 0, err
+	}
+	cursor.advance(lastKey, len(batchValues))
+	return len(batchValues), written, nil
+}
+
+// resumesAt reports whether a resume position belongs to the table/period;
+// every other table/period is migrated from the start
+func resumesAt(resume *types.Resume, table *types.Table, period Period) bool {
+	return resume != nil && resume.Table == table.Name && resume.Period == period.String()
+}
+
+// archiveSink receives the batches read by migrateToSink
+type archiveSink interface {
+	// WriteBatch stores one batch of scanned rows and returns how many rows
+	// were accepted
+	WriteBatch(rows [][]interface{}) (int64, error)
+
+	// emptyTextAsNull reports whether empty text/blob values are selected
+	// as NULL (see selectColumnList)
+	emptyTextAsNull() bool
+}
+
+// databaseSink upserts batches into an archive database table
+type databaseSink struct {
+	db      *gorm.DB
+	insert  *MergeInsert
+	mapping *TableMapping // nil when source and archive share an engine
+
+	// bypassConstraints disables constraint checks (and, on PostgreSQL,
+	// triggers) while loading; set for archives, not for restores into the
+	// live source
+	bypassConstraints bool
+
+	// nullifyEmptyText selects empty text/blob values as NULL; set for
+	// archives, not for restores, which write back what the archive holds
+	nullifyEmptyText bool
+
+	// Statement limits of the archive server, read on the first batch
+	maxParams int
+	maxBytes  int
+}
+
+func (s *databaseSink) emptyTextAsNull() bool { return s.nullifyEmptyText }
+
+func (s *databaseSink) WriteBatch(batchValues [][]interface{}) (int64, error) {
+	rowCount := int64(len(batchValues))
+
+	if s.mapping != nil {
+		for _, values := range batchValues {
+			s.mapping.ConvertRow(values)
+		}
+	}
+
+	if s.maxParams == 0 {
+		var err error
+		if s.maxParams, s.maxBytes, err = DialectOf(s.db).InsertLimits(s.db); err != nil {
+			return 0, err
+		}
 	}
 
 	// Execute batch insert
 	log.Printf("Executing batch insert with %d rows...", rowCount)
-	if err := executeBatchInsert(archiveDB, insertQuery, batchValues); err != nil {
-		log.Printf("WARNING: Batch insert had errors: %v (some rows may have succeeded)", err)
-		// Don't return error here - partial success is acceptable
-		// Only return error if ALL rows failed (handled in executeBatchInsert)
-		if err.Error() == fmt.Sprintf("all %d rows failed to insert", rowCount) {
+	written, err := executeBatchInsert(s.db, s.insert, batchValues, s.maxParams, s.maxBytes, s.bypassConstraints)
+	if err != nil {
+		if written == 0 {
 			// print recent logs for pipeline visibility
 			PrintRecentLogTail(200)
 			return 0, fmt.Errorf("failed to execute batch insert: %w", err)
 		}
+		// Partial success keeps the batch going; only the written rows are
+		// reported, so the totals and the count check show the missing ones
+		log.Printf("WARNING: Batch insert had errors: %v", err)
 	}
 
-	log.Printf("Batch insert completed")
-	return rowCount, nil
+	log.Printf("Batch insert completed: %d/%d rows written", written, rowCount)
+	return written, nil
 }
 
-// executeBatchInsert executes a batch insert/merge operation with constraint bypass for backup
-func executeBatchInsert(db *gorm.DB, query string, batchValues [][]interface{}) error {
-	log.Printf("Starting raw SQL batch insert with %d rows (constraint bypass enabled)", len(batchValues))
+// executeBatchInsert executes a batch insert/merge operation, with the
+// dialect's constraint bypass when bypassConstraints is set. The rows are
+// sent as multi-row statements sized by insertChunks, all in one
+// transaction; if a statement fails the transaction is rolled back and the
+// batch is retried row by row, so only the failing rows are lost. It returns
+// how many rows were written, with an error counting the failed rows.
+func executeBatchInsert(db *gorm.DB, insert *MergeInsert, batchValues [][]interface{}, maxParams int, maxBytes int, bypassConstraints bool) (int64, error) {
+	log.Printf("Starting raw SQL batch insert with %d rows (constraint bypass: %t)", len(batchValues), bypassConstraints)
 
 	// Get raw SQL database connection to bypass GORM constraints
 	sqlDB, err := db.DB()
 	if err != nil {
-		return fmt.Errorf("failed to get raw database connection: %w", err)
+		return 0, fmt.Errorf("failed to get raw database connection: %w", err)
 	}
 
-	// Detect database type and apply appropriate constraint bypass
-	dbType, err := detectDatabaseType(sqlDB)
+	// Pin one connection: the constraint bypass is a session setting and
+	// must apply to the connection running the inserts
+	pinned, err := sqlDB.Conn(context.Background())
 	if err != nil {
-		log.Printf("WARNING: Failed to detect database type: %v, proceeding with MySQL approach", err)
-		dbType = "mysql"
+		return 0, fmt.Errorf("failed to get database connection: %w", err)
 	}
+	defer pinned.Close()
+	conn := connExecer{pinned}
 
-	log.Printf("Detected database type: %s", dbType)
+	// Apply the dialect's constraint bypass for the duration of the batch
+	dialect := DialectOf(db)
+	if bypassConstraints {
+		defer dialect.DisableConstraints(conn)()
+	}
 
-	// Apply database-specific constraint bypass
-	switch strings.ToLower(dbType) {
-	case "postgresql", "postgres":
-		// PostgreSQL: Use session_replication_role to bypass constraints & triggers
-		if _, err := sqlDB.Exec("SET session_replication_role = replica"); err != nil {
-			log.Printf("WARNING: Failed to disable PostgreSQL constraints: %v", err)
-		}
-		defer func() {
-			if _, err := sqlDB.Exec("SET session_replication_role = origin"); err != nil {
-				log.Printf("WARNING: Failed to re-enable PostgreSQL constraints: %v", err)
-			}
-		}()
-	case "sqlite", "sqlite3":
-		// SQLite: Disable foreign key constraints (check constraints cannot be disabled)
-		if _, err := sqlDB.Exec("PRAGMA foreign_keys = OFF"); err != nil {
-			log.Printf("WARNING: Failed to disable SQLite foreign keys: %v", err)
-		}
-		defer func() {
-			if _, err := sqlDB.Exec("PRAGMA foreign_keys = ON"); err != nil {
-				log.Printf("WARNING: Failed to re-enable SQLite foreign keys: %v", err)
-			}
-		}()
-		log.Printf("NOTE: SQLite check constraints cannot be bypassed - invalid data will cause failures")
-	case "sqlserver", "mssql":
-		// SQL Server: No direct way to disable check constraints globally
-		// Alternative: Use INSERT with error handling
-		log.Printf("NOTE: SQL Server check constraints cannot be bypassed globally - using error-tolerant mode")
-	default:
-		// MySQL/MariaDB and others: Use CHECK_CONSTRAINT_CHECKS
-		if _, err := sqlDB.Exec("SET CHECK_CONSTRAINT_CHECKS = 0"); err != nil {
-			log.Printf("WARNING: Failed to disable MySQL constraints: %v", err)
-		}
-		defer func() {
-			if _, err := sqlDB.Exec("SET CHECK_CONSTRAINT_CHECKS = 1"); err != nil {
-				log.Printf("WARNING: Failed to re-enable MySQL constraints: %v", err)
-			}
-		}()
+	chunks := insertChunks(insert, batchValues, maxParams, maxBytes)
+	affected, err := insertInTransaction(pinned, insert, chunks)
+	if err == nil {
+		log.Printf("Raw SQL batch insert completed: %d rows in %d statements (rows affected: %d) (%s, constraint bypass: %t)",
+			len(batchValues), len(chunks), affected, dialect.Name(), bypassConstraints)
+		return int64(len(batchValues)), nil
 	}
+	log.Printf("WARNING: Multi-row insert failed, retrying %d rows one by one: %v", len(batchValues), err)
 
 	// Process each row with raw SQL (bypass all GORM validations)
+	query := insert.Query(1)
 	inserted := 0
 	updated := 0
 	failed := 0
+	var firstErr error
 
 	for i, values := range batchValues {
 		if i%100 == 0 && i > 0 { // Log progress every 100 rows
@@ -298,7 +412,7 @@ func executeBatchInsert(db *gorm.DB, query string, batchValues [][]interface{})
 		}
 
 		// Execute raw INSERT with ON DUPLICATE KEY UPDATE (MySQL) or ON CONFLICT (PostgreSQL)
-		result, err := sqlDB.Exec(query, values...)
+		result, err := conn.Exec(query, values...)
 		if err != nil {
 			// Log failed inserts but continue (backup mode)
 			firstValue := "unknown"
@@ -307,6 +421,9 @@ func executeBatchInsert(db *gorm.DB, query string, batchValues [][]interface{})
 			}
 
 			log.Printf("ERROR: Raw insert failed for row %d (ID: %s): %v", i+1, firstValue, err)
+			if firstErr == nil {
+				firstErr = err
+			}
 			failed++
 			continue
 		}
@@ -318,82 +435,138 @@ func executeBatchInsert(db *gorm.DB, query string, batchValues [][]interface{})
 		} else if rowsAffected == 2 {
 			updated++
 		} else if rowsAffected == 0 {
-			// This shouldn't happen with constraints disabled, but log anyway
-			log.Printf("WARNING: Row %d had 0 rows affected (ID: %v) - unexpected with constraints disabled", i+1, values[0])
+			// This shouldn't happen, but log anyway
+			log.Printf("WARNING: Row %d had 0 rows affected (ID: %v)", i+1, values[0])
 		}
 	}
 
 	// Log final summary
-	log.Printf("Raw SQL batch insert completed: %d inserted, %d updated, %d failed (total: %d) - constraints bypassed for %s",
-		inserted, updated, failed, len(batchValues), dbType)
+	log.Printf("Raw SQL batch insert completed: %d inserted, %d updated, %d failed (total: %d) (%s, constraint bypass: %t)",
+		inserted, updated, failed, len(batchValues), dialect.Name(), bypassConstraints)
 
-	return nil
+	written := int64(len(batchValues) - failed)
+	if failed > 0 {
+		return written, fmt.Errorf("%d of %d rows failed to insert (first error: %w)", failed, len(batchValues), firstErr)
+	}
+	return written, nil
 }
 
-// detectDatabaseType detects the database type from connection
-func detectDatabaseType(sqlDB *sql.DB) (string, error) {
-	var version string
-	err := sqlDB.QueryRow("SELECT version()").Scan(&version)
+// insertChunks splits a batch into runs of rows that fit one statement: at
+// most maxParams parameters and, when maxBytes > 0, an estimated size below
+// maxBytes with some headroom for protocol framing. A row too large on its
+// own still gets a statement of its own.
+func insertChunks(insert *MergeInsert, rows [][]interface{}, maxParams int, maxBytes int) [][][]interface{} {
+	maxRows := maxParams / insert.columns
+	if maxRows < 1 {
+		maxRows = 1
+	}
+	budget := maxBytes - maxBytes/10 - insert.fixedSize()
+
+	var chunks [][][]interface{}
+	start, size := 0, 0
+	for i, values := range rows {
+		rowSize := insert.rowSize(values)
+		if i > start && (i-start >= maxRows || (maxBytes > 0 && size+rowSize > budget)) {
+			chunks = append(chunks, rows[start:i])
+			start, size = i, 0
+		}
+		size += rowSize
+	}
+	if start < len(rows) {
+		chunks = append(chunks, rows[start:])
+	}
+	return chunks
+}
+
+// insertInTransaction runs one multi-row statement per chunk in a single
+// transaction and returns the rows affected reported by the server. Nothing
+// is kept when a statement fails.
+func insertInTransaction(conn *sql.Conn, insert *MergeInsert, chunks [][][]interface{}) (int64, error) {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
-		// Fallback: try SQLite syntax
-		err2 := sqlDB.QueryRow("SELECT sqlite_version()").Scan(&version)
-		if err2 == nil {
-			return "sqlite", nil
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	var affected int64
+	for _, rows := range chunks {
+		args := make([]interface{}, 0, len(rows)*insert.columns)
+		for _, values := range rows {
+			args = append(args, values...)
 		}
-		return "", fmt.Errorf("failed to detect database type: %w", err)
+		result, err := tx.ExecContext(ctx, insert.Query(len(rows)), args...)
+		if err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("failed to insert %d rows: %w", len(rows), err)
+		}
+		n, _ := result.RowsAffected()
+		affected += n
 	}
 
-	versionLower := strings.ToLower(version)
-	if strings.Contains(versionLower, "postgresql") || strings.Contains(versionLower, "postgres") {
-		return "postgresql", nil
-	} else if strings.Contains(versionLower, "mariadb") {
-		return "mariadb", nil
-	} else if strings.Contains(versionLower, "mysql") {
-		return "mysql", nil
-	} else if strings.Contains(versionLower, "microsoft") || strings.Contains(versionLower, "sql server") {
-		return "sqlserver", nil
-	} else if strings.Contains(versionLower, "sqlite") {
-		return "sqlite", nil
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit batch: %w", err)
 	}
+	return affected, nil
+}
 
-	return "unknown", nil
+// connExecer runs statements on a pinned connection
+type connExecer struct{ conn *sql.Conn }
+
+func (c connExecer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.conn.ExecContext(context.Background(), query, args...)
 }
 
 // DeleteMigratedData deletes the migrated data from source table if configured
-func DeleteMigratedData(sourceDB *gorm.DB, table *types.Table, year int, config *types.ArchiveOptions) error {
+func DeleteMigratedData(sourceDB *gorm.DB, table *types.Table, period Period, config *types.ArchiveOptions) error {
 	if !config.DeleteAfterArchive {
-		log.Printf("Skipping data deletion for table %s, year %d (delete_after_archive is false)", table.Name, year)
+		log.Printf("Skipping data deletion for table %s, period %s (delete_after_archive is false)", table.Name, period)
 		return nil
 	}
 
-	log.Printf("Deleting migrated data for table %s, year %d", table.Name, year)
+	// File exports may only be purged once their manifest is sealed
+	if table.Export != nil {
+		if err := requireSealedExport(table, period); err != nil {
+			return err
+		}
+	}
 
-	deleteQuery := fmt.Sprintf("DELETE FROM `%s` WHERE YEAR(`%s`) = %d", table.Name, table.SplitColumn, year)
+	log.Printf("Deleting migrated data for table %s, period %s", table.Name, period)
+
+	condition, args, err := periodCondition(sourceDB, table, period, nil)
+	if err != nil {
+		return err
+	}
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE %s", DialectOf(sourceDB).QuoteIdent(table.Name), condition)
 
 	// Run delete with GORM SQL logging silenced to avoid raw SQL being emitted to pipeline logs
 	// (some remote runners may add quoting around logged SQL which can cause command failures).
 	silentDB := sourceDB.Session(&gorm.Session{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
-	result := silentDB.Exec(deleteQuery)
+	result := silentDB.Exec(deleteQuery, args...)
 	if result.Error != nil {
 		return fmt.Errorf("failed to delete migrated data: %w", result.Error)
 	}
 
 	deletedRows := result.RowsAffected
-	log.Printf("Deleted %d rows from source table %s, year %d", deletedRows, table.Name, year)
+	log.Printf("Deleted %d rows from source table %s, period %s", deletedRows, table.Name, period)
 
 	return nil
 }
 
-// ValidateMigration validates that the migration was successful
-func ValidateMigration(sourceDB *gorm.DB, archiveDB *gorm.DB, table *types.Table, year int) error {
+// ValidateMigration validates that the migration was successful. For file
+// exports archiveDB is unused and the source is checked against the manifest.
+func ValidateMigration(sourceDB *gorm.DB, archiveDB *gorm.DB, table *types.Table, period Period) error {
+	if table.Export != nil {
+		return ValidateExport(sourceDB, table, period)
+	}
+
 	// Count rows in source
-	sourceCount, err := GetRowCount(sourceDB, table.Name, table.SplitColumn, year)
+	sourceCount, err := GetRowCount(sourceDB, table, period)
 	if err != nil {
 		return fmt.Errorf("failed to count source rows: %w", err)
 	}
 
-	// Count rows in archive for this year
-	archiveCount, err := GetRowCount(archiveDB, table.Name, table.SplitColumn, year)
+	// Count rows in archive for this period
+	archiveCount, err := GetRowCount(archiveDB, table, period)
 	if err != nil {
 		return fmt.Errorf("failed to count archive rows: %w", err)
 	}
@@ -404,6 +577,6 @@ func ValidateMigration(sourceDB *gorm.DB, archiveDB *gorm.DB, table *types.Table
 		return fmt.Errorf("migration validation failed: source has %d rows, archive has %d rows (expected at least %d)", sourceCount, archiveCount, sourceCount)
 	}
 
-	log.Printf("Migration validation successful for table %s, year %d: source=%d, archive=%d rows", table.Name, year, sourceCount, archiveCount)
+	log.Printf("Migration validation successful for table %s, period %s: source=%d, archive=%d rows", table.Name, period, sourceCount, archiveCount)
 	return nil
 }
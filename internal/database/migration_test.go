@@ -0,0 +1,128 @@
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"data-splitter/pkg/types"
+)
+
+func testMergeInsert(t *testing.T, dialect Dialect) *MergeInsert {
+	t.Helper()
+	insert, err := BuildMergeInsert(dialect, "orders", []ColumnInfo{
+		{Field: "id", Key: "PRI"}, {Field: "note"}, {Field: "total"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return insert
+}
+
+func TestMergeInsertQuery(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		rows    int
+		want    string
+	}{
+		{mysqlDialect{}, 1, "INSERT INTO `orders` (`id`, `note`, `total`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `note` = VALUES(`note`), `total` = VALUES(`total`)"},
+		{mysqlDialect{}, 2, "INSERT INTO `orders` (`id`, `note`, `total`) VALUES (?, ?, ?), (?, ?, ?) ON DUPLICATE KEY UPDATE `note` = VALUES(`note`), `total` = VALUES(`total`)"},
+		{postgresDialect{}, 2, `INSERT INTO "orders" ("id", "note", "total") VALUES ($1, $2, $3), ($4, $5, $6) ON CONFLICT ("id") DO UPDATE SET "note" = EXCLUDED."note", "total" = EXCLUDED."total"`},
+	}
+
+	for _, tt := range tests {
+		if got := testMergeInsert(t, tt.dialect).Query(tt.rows); got != tt.want {
+			t.Errorf("%s Query(%d) = %q, want %q", tt.dialect.Name(), tt.rows, got, tt.want)
+		}
+	}
+}
+
+func chunkSizes(chunks [][][]interface{}) []int {
+	sizes := make([]int, len(chunks))
+	for i, chunk := range chunks {
+		sizes[i] = len(chunk)
+	}
+	return sizes
+}
+
+func TestInsertChunks(t *testing.T) {
+	insert := testMergeInsert(t, mysqlDialect{})
+	row := func(note string) []interface{} { return []interface{}{int64(1), note, 9.5} }
+	small := row("x")
+	large := row(strings.Repeat("x", 400))
+
+	tests := []struct {
+		name      string
+		rows      [][]interface{}
+		maxParams int
+		maxBytes  int
+		want      []int
+	}{
+		{"no rows", nil, 65535, 0, []int{}},
+		{"one statement", [][]interface{}{small, small, small}, 65535, 0, []int{3}},
+		{"parameter limit", [][]interface{}{small, small, small, small, small}, 7, 0, []int{2, 2, 1}},
+		{"limit below one row", [][]interface{}{small, small}, 2, 0, []int{1, 1}},
+		{"byte limit", [][]interface{}{large, large, large, large}, 65535, 2400, []int{2, 2}},
+		{"row larger than the limit", [][]interface{}{small, large, small}, 65535, 600, []int{1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		chunks := insertChunks(insert, tt.rows, tt.maxParams, tt.maxBytes)
+		got := chunkSizes(chunks)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: chunk sizes = %v, want %v", tt.name, got, tt.want)
+		}
+		for _, chunk := range chunks {
+			if params := len(chunk) * 3; len(chunk) > 1 && params > tt.maxParams {
+				t.Errorf("%s: chunk of %d rows uses %d parameters, limit %d", tt.name, len(chunk), params, tt.maxParams)
+			}
+		}
+	}
+}
+
+// Rows failing in the row by row fallback are counted, not dropped silently
+func TestExecuteBatchInsertFailedRows(t *testing.T) {
+	table := &types.Table{ArchivePattern: filepath.Join(t.TempDir(), "archive.sqlite")}
+	db, err := ConnectArchiveDB(&types.Database{}, table, YearPeriod(2024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseConnection(db)
+	if err := db.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY, note TEXT, total REAL CHECK (total >= 0))`).Error; err != nil {
+		t.Fatal(err)
+	}
+	insert := testMergeInsert(t, DialectOf(db))
+
+	tests := []struct {
+		name        string
+		rows        [][]interface{}
+		wantWritten int64
+		wantErr     string
+	}{
+		{"all written", [][]interface{}{{int64(1), "a", 1.0}, {int64(2), "b", 2.0}}, 2, ""},
+		{"some failed", [][]interface{}{{int64(3), "c", 3.0}, {int64(4), "d", -1.0}, {int64(5), "e", 5.0}}, 2, "1 of 3 rows failed to insert"},
+		{"all failed", [][]interface{}{{int64(6), "f", -1.0}, {int64(7), "g", -2.0}}, 0, "2 of 2 rows failed to insert"},
+	}
+
+	for _, tt := range tests {
+		written, err := executeBatchInsert(db, insert, tt.rows, 65535, 0, false)
+		if written != tt.wantWritten {
+			t.Errorf("%s: written = %d, want %d", tt.name, written, tt.wantWritten)
+		}
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	sink := &databaseSink{db: db, insert: insert}
+	if written, err := sink.WriteBatch([][]interface{}{{int64(8), "h", 8.0}, {int64(9), "i", -9.0}}); err != nil || written != 1 {
+		t.Errorf("WriteBatch with one failed row = %d, %v, want 1, nil", written, err)
+	}
+	if written, err := sink.WriteBatch([][]interface{}{{int64(10), "j", -10.0}}); err == nil || written != 0 {
+		t.Errorf("WriteBatch with every row failed = %d, %v, want 0 and an error", written, err)
+	}
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"data-splitter/pkg/types"
+)
+
+// A period is closed once its end plus archive.options.grace_period has
+// passed in the business time zone. Open periods may still receive rows, so
+// archiving (and deleting) them is refused unless --allow-open-period is
+// given.
+
+// ValidateGracePeriod checks a grace_period setting such as "30d" or
+// "1 month" ("" means no grace period)
+func ValidateGracePeriod(grace string) error {
+	if grace == "" {
+		return nil
+	}
+	_, err := parseRetentionSpan(grace)
+	return err
+}
+
+// periodClosedAt returns the wall clock (in the table's time zone) from which a
+// period counts as closed: its end plus the grace period
+func periodClosedAt(period Period, grace string) (time.Time, error) {
+	if grace == "" {
+		return period.End, nil
+	}
+	span, err := parseRetentionSpan(grace)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid grace_period: %w", err)
+	}
+	return span.subtract(period.End, -span.n), nil
+}
+
+// CheckPeriodClosed returns an error describing why a period of a table is
+// still open at now, or nil once it has closed
+func CheckPeriodClosed(table *types.Table, period Period, grace string, now time.Time) error {
+	loc, err := LoadTimeZone(table.TimeZone)
+	if err != nil {
+		return err
+	}
+	closedAt, err := periodClosedAt(period, grace)
+	if err != nil {
+		return err
+	}
+
+	now = wallClock(now.In(loc))
+	if !now.Before(closedAt) {
+		return nil
+	}
+
+	if grace == "" {
+		return fmt.Errorf("period %s of table %s has not closed: it ends %s (now %s, time_zone %s)",
+			period, table.Name, period.End.Format("2006-01-02T15:04:05"), now.Format("2006-01-02T15:04:05"), loc)
+	}
+	return fmt.Errorf("period %s of table %s has not closed: it ends %s and grace_period %s runs until %s (now %s, time_zone %s)",
+		period, table.Name, period.End.Format("2006-01-02T15:04:05"), grace,
+		closedAt.Format("2006-01-02T15:04:05"), now.Format("2006-01-02T15:04:05"), loc)
+}
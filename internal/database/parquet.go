@@ -0,0 +1,371 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/writerfile"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/types"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Parquet exports use the same fileSink as CSV/NDJSON: every part file is a
+// self-contained Parquet file whose schema is derived from the source column
+// types. Compression happens inside Parquet pages, so the part file itself
+// is never wrapped in gzip/zstd.
+
+// defaultRowGroupSizeMB is the row group size used when row_group_size_mb is unset
+const defaultRowGroupSizeMB = 128
+
+// parquetColumn describes how one source column is written to Parquet
+type parquetColumn struct {
+	name     string
+	tag      string // parquet-go schema metadata
+	required bool
+	convert  func(interface{}) (interface{}, error)
+}
+
+// parquetEncoder writes rows into one Parquet file
+type parquetEncoder struct {
+	pw      *writer.CSVWriter
+	columns []parquetColumn
+}
+
+func newParquetEncoder(w io.Writer, columns []ColumnInfo, compression string, rowGroupSizeMB int) (*parquetEncoder, error) {
+	pcols := make([]parquetColumn, len(columns))
+	md := make([]string, len(columns))
+	for i, col := range columns {
+		if strings.ContainsAny(col.Field, ",=") {
+			return nil, fmt.Errorf("column name %q cannot be written to Parquet", col.Field)
+		}
+		pcols[i] = buildParquetColumn(col)
+		md[i] = pcols[i].tag
+	}
+
+	pw, err := writer.NewCSVWriter(md, writerfile.NewWriterFile(w), 4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Parquet writer: %w", err)
+	}
+
+	codec, err := parquetCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+	pw.CompressionType = codec
+
+	if rowGroupSizeMB <= 0 {
+		rowGroupSizeMB = defaultRowGroupSizeMB
+	}
+	pw.RowGroupSize = int64(rowGroupSizeMB) * 1024 * 1024
+
+	return &parquetEncoder{pw: pw, columns: pcols}, nil
+}
+
+func (e *parquetEncoder) WriteRow(values []interface{}) error {
+	// The writer buffers records until a row group is flushed, so each row
+	// needs its own slice
+	rec := make([]interface{}, len(values))
+	for i, v := range values {
+		col := e.columns[i]
+		if v == nil {
+			if col.required {
+				return fmt.Errorf("column %s is NOT NULL but returned NULL", col.name)
+			}
+			continue
+		}
+
+		converted, err := col.convert(v)
+		if err != nil {
+			return fmt.Errorf("failed to convert column %s: %w", col.name, err)
+		}
+		rec[i] = converted
+	}
+
+	return e.pw.Write(rec)
+}
+
+// Flush writes the remaining row group and the file footer
+func (e *parquetEncoder) Flush() error {
+	return e.pw.WriteStop()
+}
+
+// parquetCodec maps the export compression setting onto a Parquet codec
+func parquetCodec(compression string) (parquet.CompressionCodec, error) {
+	switch compression {
+	case "", "snappy":
+		return parquet.CompressionCodec_SNAPPY, nil
+	case "gzip":
+		return parquet.CompressionCodec_GZIP, nil
+	case "zstd":
+		return parquet.CompressionCodec_ZSTD, nil
+	case "none":
+		return parquet.CompressionCodec_UNCOMPRESSED, nil
+	default:
+		return 0, fmt.Errorf("unsupported Parquet compression %q", compression)
+	}
+}
+
+// buildParquetColumn derives the Parquet type of a source column:
+//   - integers use INT32/INT64 (unsigned BIGINT becomes DECIMAL(20,0))
+//   - DECIMAL(p,s) keeps its precision and scale (INT64 up to 18 digits,
+//     BYTE_ARRAY above); NUMERIC without precision is written as a string
+//   - DATETIME / timestamp without time zone are TIMESTAMP(MICROS) with
+//     isAdjustedToUTC=false (wall clock); timestamptz uses isAdjustedToUTC=true
+//   - TEXT, JSON, ENUM, SET, UUID and TIME are UTF8 strings
+func buildParquetColumn(col ColumnInfo) parquetColumn {
+	lt := ParseColumnType(col.Type)
+	pc := parquetColumn{name: col.Field, required: col.Null == "NO"}
+
+	repetition := "OPTIONAL"
+	if pc.required {
+		repetition = "REQUIRED"
+	}
+	tag := func(format string, args ...interface{}) string {
+		return fmt.Sprintf("name=%s, ", col.Field) + fmt.Sprintf(format, args...) + ", repetitiontype=" + repetition
+	}
+
+	switch {
+	case lt.Kind == KindBool || (lt.Kind == KindBit && lt.Bits == 1):
+		pc.tag = tag("type=BOOLEAN")
+		pc.convert = parquetBool
+
+	case lt.Kind == KindInt && lt.Unsigned && lt.Bits == 64:
+		pc.tag = tag("type=BYTE_ARRAY, convertedtype=DECIMAL, precision=20, scale=0")
+		pc.convert = parquetBigDecimal(0)
+
+	case lt.Kind == KindInt && (lt.Bits == 64 || (lt.Unsigned && lt.Bits == 32)), lt.Kind == KindBit:
+		pc.tag = tag("type=INT64")
+		pc.convert = parquetInt64
+
+	case lt.Kind == KindInt, lt.Kind == KindYear:
+		pc.tag = tag("type=INT32")
+		pc.convert = parquetInt32
+
+	case lt.Kind == KindDecimal && lt.Precision > 0 && lt.Precision <= 18:
+		pc.tag = tag("type=INT64, convertedtype=DECIMAL, precision=%d, scale=%d", lt.Precision, lt.Scale)
+		pc.convert = parquetInt64Decimal(lt.Scale)
+
+	case lt.Kind == KindDecimal && lt.Precision > 18:
+		pc.tag = tag("type=BYTE_ARRAY, convertedtype=DECIMAL, precision=%d, scale=%d", lt.Precision, lt.Scale)
+		pc.convert = parquetBigDecimal(lt.Scale)
+
+	case lt.Kind == KindFloat && lt.Bits == 32:
+		pc.tag = tag("type=FLOAT")
+		pc.convert = parquetFloat32
+
+	case lt.Kind == KindFloat:
+		pc.tag = tag("type=DOUBLE")
+		pc.convert = parquetFloat64
+
+	case lt.Kind == KindDate:
+		pc.tag = tag("type=INT32, convertedtype=DATE")
+		pc.convert = parquetDate
+
+	case lt.Kind == KindDateTime:
+		pc.tag = tag("type=INT64, logicaltype=TIMESTAMP, logicaltype.isadjustedtoutc=false, logicaltype.unit=MICROS")
+		pc.convert = parquetWallClockMicros
+
+	case lt.Kind == KindTimestampTZ:
+		pc.tag = tag("type=INT64, logicaltype=TIMESTAMP, logicaltype.isadjustedtoutc=true, logicaltype.unit=MICROS")
+		pc.convert = parquetUTCMicros
+
+	case lt.Kind == KindBinary:
+		pc.tag = tag("type=BYTE_ARRAY")
+		pc.convert = parquetString
+
+	default:
+		pc.tag = tag("type=BYTE_ARRAY, convertedtype=UTF8")
+		pc.convert = parquetString
+	}
+
+	return pc
+}
+
+// Value converters for Parquet columns. Values arrive as scanned by the
+// source driver: integers as int64/uint64, text and decimals as []byte (or
+// string), timestamps as time.Time.
+
+func parquetString(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case []byte:
+		return string(x), nil
+	case string:
+		return x, nil
+	case time.Time:
+		return x.Format("2006-01-02 15:04:05.999999999"), nil
+	default:
+		return fmt.Sprint(x), nil
+	}
+}
+
+func parquetBool(v interface{}) (interface{}, error) {
+	if b, ok := v.([]byte); ok && len(b) == 1 && b[0] <= 1 {
+		return b[0] == 1, nil
+	}
+	if b, ok := toBool(v).(bool); ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("unexpected boolean value %v", v)
+}
+
+func parquetInt64(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case int64:
+		return x, nil
+	case uint64:
+		return int64(x), nil
+	case []byte:
+		if n, err := strconv.ParseInt(string(x), 10, 64); err == nil {
+			return n, nil
+		}
+		// BIT(n) columns arrive as big-endian bytes
+		return bitsToInt(x), nil
+	case string:
+		return strconv.ParseInt(x, 10, 64)
+	case bool:
+		if x {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+	return nil, fmt.Errorf("unexpected integer value %v (%T)", v, v)
+}
+
+func parquetInt32(v interface{}) (interface{}, error) {
+	n, err := parquetInt64(v)
+	if err != nil {
+		return nil, err
+	}
+	return int32(n.(int64)), nil
+}
+
+func parquetFloat64(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case float64:
+		return x, nil
+	case float32:
+		return float64(x), nil
+	case int64:
+		return float64(x), nil
+	case []byte:
+		return strconv.ParseFloat(string(x), 64)
+	case string:
+		return strconv.ParseFloat(x, 64)
+	}
+	return nil, fmt.Errorf("unexpected float value %v (%T)", v, v)
+}
+
+func parquetFloat32(v interface{}) (interface{}, error) {
+	f, err := parquetFloat64(v)
+	if err != nil {
+		return nil, err
+	}
+	return float32(f.(float64)), nil
+}
+
+func parquetDate(v interface{}) (interface{}, error) {
+	t, err := parquetTime(v)
+	if err != nil {
+		return nil, err
+	}
+	days := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+	return int32(days), nil
+}
+
+// parquetWallClockMicros keeps the wall clock reading of zone-less columns
+func parquetWallClockMicros(v interface{}) (interface{}, error) {
+	t, err := parquetTime(v)
+	if err != nil {
+		return nil, err
+	}
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return wall.UnixMicro(), nil
+}
+
+func parquetUTCMicros(v interface{}) (interface{}, error) {
+	t, err := parquetTime(v)
+	if err != nil {
+		return nil, err
+	}
+	return t.UnixMicro(), nil
+}
+
+// parquetTime accepts time.Time or the textual forms drivers fall back to
+func parquetTime(v interface{}) (time.Time, error) {
+	var s string
+	switch x := v.(type) {
+	case time.Time:
+		return x, nil
+	case []byte:
+		s = string(x)
+	case string:
+		s = x
+	default:
+		return time.Time{}, fmt.Errorf("unexpected time value %v (%T)", v, v)
+	}
+
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse time value %q", s)
+}
+
+// decimalUnscaled returns value * 10^scale as an integer, which is how
+// Parquet stores DECIMAL values
+func decimalUnscaled(v interface{}, scale int) (*big.Int, error) {
+	var s string
+	switch x := v.(type) {
+	case []byte:
+		s = string(x)
+	case string:
+		s = x
+	case int64:
+		s = strconv.FormatInt(x, 10)
+	case uint64:
+		s = strconv.FormatUint(x, 10)
+	case float64:
+		s = strconv.FormatFloat(x, 'f', -1, 64)
+	default:
+		return nil, fmt.Errorf("unexpected decimal value %v (%T)", v, v)
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("cannot parse decimal value %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	if !r.IsInt() {
+		return nil, fmt.Errorf("decimal value %q has more than %d fractional digits", s, scale)
+	}
+	return r.Num(), nil
+}
+
+func parquetInt64Decimal(scale int) func(interface{}) (interface{}, error) {
+	return func(v interface{}) (interface{}, error) {
+		n, err := decimalUnscaled(v, scale)
+		if err != nil {
+			return nil, err
+		}
+		if !n.IsInt64() {
+			return nil, fmt.Errorf("decimal value %v out of range", v)
+		}
+		return n.Int64(), nil
+	}
+}
+
+func parquetBigDecimal(scale int) func(interface{}) (interface{}, error) {
+	return func(v interface{}) (interface{}, error) {
+		n, err := decimalUnscaled(v, scale)
+		if err != nil {
+			return nil, err
+		}
+		return types.StrIntToBinary(n.String(), "BigEndian", 0, true), nil
+	}
+}
@@ -0,0 +1,280 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-splitter/pkg/types"
+)
+
+// Granularities accepted by table.granularity
+const (
+	GranularityYear    = "year"
+	GranularityQuarter = "quarter"
+	GranularityMonth   = "month"
+	GranularityDay     = "day"
+)
+
+// granularityRank orders granularities from coarsest to finest
+var granularityRank = map[string]int{
+	GranularityYear:    0,
+	GranularityQuarter: 1,
+	GranularityMonth:   2,
+	GranularityDay:     3,
+}
+
+// ValidGranularity reports whether g is a supported granularity ("" means year)
+func ValidGranularity(g string) bool {
+	_, ok := granularityRank[normalizeGranularity(g)]
+	return ok
+}
+
+func normalizeGranularity(g string) string {
+	g = strings.ToLower(strings.TrimSpace(g))
+	if g == "" {
+		return GranularityYear
+	}
+	return g
+}
+
+// Period is one archive unit of a table: a (fiscal) year, quarter, month or
+// day. Start is inclusive and End exclusive; both are calendar dates (UTC
+// is used only as a neutral location for the wall clock values).
+type Period struct {
+	Granularity string
+	Start       time.Time
+	End         time.Time
+	// FiscalYearStart is the month (1-12) the table's year starts in; 0 and
+	// 1 mean calendar years. Fiscal years are labeled by the calendar year
+	// they end in: with April as the start, 2025 runs from 2024-04-01 to
+	// 2025-04-01 and its Q1 is April-June 2024.
+	FiscalYearStart int
+}
+
+// YearPeriod returns the period covering a calendar year
+func YearPeriod(year int) Period {
+	return FiscalYearPeriod(year, 1)
+}
+
+// FiscalYearPeriod returns the period covering the fiscal year labeled year
+// for a fiscal year starting in month startMonth (1 = calendar year)
+func FiscalYearPeriod(year int, startMonth int) Period {
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	if startMonth > 1 {
+		start = time.Date(year-1, time.Month(startMonth), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return inFiscalYear(newPeriod(GranularityYear, start), startMonth)
+}
+
+// inFiscalYear labels p with a fiscal year start month (1 = calendar year)
+func inFiscalYear(p Period, startMonth int) Period {
+	if startMonth > 1 {
+		p.FiscalYearStart = startMonth
+	}
+	return p
+}
+
+// newPeriod returns the period of the given granularity starting at start,
+// which must be the first day of that period
+func newPeriod(granularity string, start time.Time) Period {
+	var end time.Time
+	switch granularity {
+	case GranularityQuarter:
+		end = start.AddDate(0, 3, 0)
+	case GranularityMonth:
+		end = start.AddDate(0, 1, 0)
+	case GranularityDay:
+		end = start.AddDate(0, 0, 1)
+	default:
+		granularity = GranularityYear
+		end = start.AddDate(1, 0, 0)
+	}
+	return Period{Granularity: granularity, Start: start, End: end}
+}
+
+// whole returns the full period of a period that may end early at a group
+// cutoff (see ClampPeriod)
+func (p Period) whole() Period {
+	whole := newPeriod(p.Granularity, p.Start)
+	whole.FiscalYearStart = p.FiscalYearStart
+	return whole
+}
+
+// fiscalStart returns the month the period's year starts in
+func (p Period) fiscalStart() int {
+	if p.FiscalYearStart < 1 {
+		return 1
+	}
+	return p.FiscalYearStart
+}
+
+// Year returns the (fiscal) year label of the period
+func (p Period) Year() int {
+	if fs := p.fiscalStart(); fs > 1 && p.Month() >= fs {
+		return p.Start.Year() + 1
+	}
+	return p.Start.Year()
+}
+
+func (p Period) Month() int { return int(p.Start.Month()) }
+
+// Quarter returns the (fiscal) quarter, 1-4
+func (p Period) Quarter() int { return (p.Month()-p.fiscalStart()+12)%12/3 + 1 }
+
+func (p Period) Day() int { return p.Start.Day() }
+
+// String returns the period label: 2024, 2024-Q1, 2024-01 or 2024-01-15.
+// Years and quarters are fiscal for tables with a fiscal_year_start.
+func (p Period) String() string {
+	switch p.Granularity {
+	case GranularityQuarter:
+		return fmt.Sprintf("%d-Q%d", p.Year(), p.Quarter())
+	case GranularityMonth:
+		return p.Start.Format("2006-01")
+	case GranularityDay:
+		return p.Start.Format("2006-01-02")
+	default:
+		return strconv.Itoa(p.Year())
+	}
+}
+
+// PeriodKeys renders the period for PROGRESS/FINAL lines. Yearly periods
+// keep the historical "year=N" form; finer periods add "period=<label>".
+func PeriodKeys(p Period) string {
+	if p.Granularity == GranularityYear {
+		return fmt.Sprintf("year=%d", p.Year())
+	}
+	return fmt.Sprintf("year=%d period=%s", p.Year(), p)
+}
+
+// split returns the periods of the given (equal or finer) granularity
+// covering p
+func (p Period) split(granularity string) []Period {
+	var periods []Period
+	for start := p.Start; start.Before(p.End); {
+		period := newPeriod(granularity, start)
+		period.FiscalYearStart = p.FiscalYearStart
+		periods = append(periods, period)
+		start = period.End
+	}
+	return periods
+}
+
+// parsePeriodLabel parses a single label and reports its own granularity;
+// year and quarter labels are fiscal when fiscalYearStart is after January
+func parsePeriodLabel(label string, fiscalYearStart int) (Period, error) {
+	label = strings.TrimSpace(label)
+	if year, quarter, ok := strings.Cut(strings.ToUpper(label), "-Q"); ok {
+		y, errY := strconv.Atoi(year)
+		q, errQ := strconv.Atoi(quarter)
+		if errY != nil || errQ != nil || q < 1 || q > 4 {
+			return Period{}, fmt.Errorf("invalid quarter %q (expected e.g. 2024-Q1)", label)
+		}
+		start := FiscalYearPeriod(y, fiscalYearStart).Start.AddDate(0, (q-1)*3, 0)
+		return inFiscalYear(newPeriod(GranularityQuarter, start), fiscalYearStart), nil
+	}
+	if len(label) == 4 {
+		if y, err := strconv.Atoi(label); err == nil {
+			return FiscalYearPeriod(y, fiscalYearStart), nil
+		}
+	}
+
+	layouts := []struct {
+		layout      string
+		granularity string
+	}{
+		{"2006-01", GranularityMonth},
+		{"2006-01-02", GranularityDay},
+	}
+	for _, l := range layouts {
+		if len(label) != len(l.layout) {
+			continue
+		}
+		if start, err := time.Parse(l.layout, label); err == nil {
+			return inFiscalYear(newPeriod(l.granularity, start), fiscalYearStart), nil
+		}
+	}
+	return Period{}, fmt.Errorf("invalid period %q (expected 2024, 2024-Q1, 2024-01 or 2024-01-15)", label)
+}
+
+// ParsePeriods parses a period spec for a table of the given granularity
+// and fiscal year start month (0 or 1 = calendar years). The spec is a
+// label (2024, 2024-Q1, 2024-01, 2024-01-15) or an inclusive range of labels
+// ("2024-01..2024-06"). Labels coarser than the granularity expand to all
+// periods they contain; finer labels are rejected.
+func ParsePeriods(granularity string, fiscalYearStart int, spec string) ([]Period, error) {
+	granularity = normalizeGranularity(granularity)
+	if _, ok := granularityRank[granularity]; !ok {
+		return nil, fmt.Errorf("invalid granularity %q (expected year, quarter, month or day)", granularity)
+	}
+
+	from, to, isRange := strings.Cut(spec, "..")
+	first, err := parsePeriodLabel(from, fiscalYearStart)
+	if err != nil {
+		return nil, err
+	}
+	last := first
+	if isRange {
+		if last, err = parsePeriodLabel(to, fiscalYearStart); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range []Period{first, last} {
+		if granularityRank[p.Granularity] > granularityRank[granularity] {
+			return nil, fmt.Errorf("period %s is finer than the table granularity %s", p, granularity)
+		}
+	}
+	if !last.End.After(first.Start) {
+		return nil, fmt.Errorf("invalid period range %q: end is before start", spec)
+	}
+
+	span := inFiscalYear(Period{Granularity: granularity, Start: first.Start, End: last.End}, fiscalYearStart)
+	return span.split(granularity), nil
+}
+
+// TablePeriods returns the periods a table is archived in: its own
+// periods list when set, otherwise every period of archive.years (fiscal
+// years for tables with a fiscal_year_start) at the table granularity
+func TablePeriods(table *types.Table, years []int) ([]Period, error) {
+	granularity := normalizeGranularity(table.Granularity)
+
+	var periods []Period
+	if len(table.Periods) > 0 {
+		for _, spec := range table.Periods {
+			parsed, err := ParsePeriods(granularity, table.FiscalYearStart, spec)
+			if err != nil {
+				return nil, err
+			}
+			periods = append(periods, parsed...)
+		}
+		return periods, nil
+	}
+
+	for _, year := range years {
+		periods = append(periods, FiscalYearPeriod(year, table.FiscalYearStart).split(granularity)...)
+	}
+	return periods, nil
+}
+
+// patternTokens maps the period placeholders of archive_pattern to the
+// granularity they need
+var patternTokens = map[string]string{
+	"{quarter}": GranularityQuarter,
+	"{month}":   GranularityMonth,
+	"{day}":     GranularityDay,
+}
+
+// CheckPatternGranularity rejects placeholders finer than the table
+// granularity, e.g. {month} in the pattern of a yearly table
+func CheckPatternGranularity(pattern, granularity string) error {
+	granularity = normalizeGranularity(granularity)
+	for token, needs := range patternTokens {
+		if strings.Contains(pattern, token) && granularityRank[needs] > granularityRank[granularity] {
+			return fmt.Errorf("placeholder %s needs granularity %s or finer (table granularity is %s)", token, needs, granularity)
+		}
+	}
+	return nil
+}
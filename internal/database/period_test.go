@@ -0,0 +1,111 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParsePeriodLabel(t *testing.T) {
+	tests := []struct {
+		label           string
+		fiscalYearStart int
+		granularity     string
+		start, end      time.Time
+		want            string
+	}{
+		{"2024", 0, GranularityYear, date(2024, 1, 1), date(2025, 1, 1), "2024"},
+		{" 2024 ", 1, GranularityYear, date(2024, 1, 1), date(2025, 1, 1), "2024"},
+		{"2024-Q2", 0, GranularityQuarter, date(2024, 4, 1), date(2024, 7, 1), "2024-Q2"},
+		{"2024-q4", 0, GranularityQuarter, date(2024, 10, 1), date(2025, 1, 1), "2024-Q4"},
+		{"2024-03", 0, GranularityMonth, date(2024, 3, 1), date(2024, 4, 1), "2024-03"},
+		{"2024-02-29", 0, GranularityDay, date(2024, 2, 29), date(2024, 3, 1), "2024-02-29"},
+
+		// Fiscal years are labeled by the calendar year they end in
+		{"2025", 4, GranularityYear, date(2024, 4, 1), date(2025, 4, 1), "2025"},
+		{"2025-Q1", 4, GranularityQuarter, date(2024, 4, 1), date(2024, 7, 1), "2025-Q1"},
+		{"2025-Q4", 4, GranularityQuarter, date(2025, 1, 1), date(2025, 4, 1), "2025-Q4"},
+		{"2025-Q1", 7, GranularityQuarter, date(2024, 7, 1), date(2024, 10, 1), "2025-Q1"},
+		{"2024-05", 4, GranularityMonth, date(2024, 5, 1), date(2024, 6, 1), "2024-05"},
+	}
+
+	for _, tt := range tests {
+		p, err := parsePeriodLabel(tt.label, tt.fiscalYearStart)
+		if err != nil {
+			t.Errorf("parsePeriodLabel(%q, %d): %v", tt.label, tt.fiscalYearStart, err)
+			continue
+		}
+		if p.Granularity != tt.granularity || !p.Start.Equal(tt.start) || !p.End.Equal(tt.end) || p.String() != tt.want {
+			t.Errorf("parsePeriodLabel(%q, %d) = %s %s %s..%s, want %s %s %s..%s", tt.label, tt.fiscalYearStart,
+				p.Granularity, p, p.Start.Format("2006-01-02"), p.End.Format("2006-01-02"),
+				tt.granularity, tt.want, tt.start.Format("2006-01-02"), tt.end.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestParsePeriodLabelInvalid(t *testing.T) {
+	for _, label := range []string{"", "24", "2024-Q0", "2024-Q5", "2024-QX", "2024-13", "2023-02-29", "2024/01", "01-2024"} {
+		if p, err := parsePeriodLabel(label, 0); err == nil {
+			t.Errorf("parsePeriodLabel(%q) = %s, want an error", label, p)
+		}
+	}
+}
+
+func TestParsePeriods(t *testing.T) {
+	tests := []struct {
+		granularity     string
+		fiscalYearStart int
+		spec            string
+		want            []string
+	}{
+		{"year", 0, "2024", []string{"2024"}},
+		{"", 0, "2022..2024", []string{"2022", "2023", "2024"}},
+		{"quarter", 0, "2024", []string{"2024-Q1", "2024-Q2", "2024-Q3", "2024-Q4"}},
+		{"month", 0, "2024-Q1", []string{"2024-01", "2024-02", "2024-03"}},
+		{"month", 0, "2024-11..2025-02", []string{"2024-11", "2024-12", "2025-01", "2025-02"}},
+		{"day", 0, "2024-02-28..2024-03-01", []string{"2024-02-28", "2024-02-29", "2024-03-01"}},
+		{"quarter", 4, "2025", []string{"2025-Q1", "2025-Q2", "2025-Q3", "2025-Q4"}},
+		{"month", 4, "2025-Q4", []string{"2025-01", "2025-02", "2025-03"}},
+		{"quarter", 4, "2025-Q3..2026-Q1", []string{"2025-Q3", "2025-Q4", "2026-Q1"}},
+	}
+
+	for _, tt := range tests {
+		periods, err := ParsePeriods(tt.granularity, tt.fiscalYearStart, tt.spec)
+		if err != nil {
+			t.Errorf("ParsePeriods(%q, %d, %q): %v", tt.granularity, tt.fiscalYearStart, tt.spec, err)
+			continue
+		}
+		got := make([]string, len(periods))
+		for i, p := range periods {
+			got[i] = p.String()
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("ParsePeriods(%q, %d, %q) = %v, want %v", tt.granularity, tt.fiscalYearStart, tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParsePeriodsInvalid(t *testing.T) {
+	tests := []struct {
+		granularity string
+		spec        string
+		wantErr     string
+	}{
+		{"week", "2024", "invalid granularity"},
+		{"year", "2024-01", "finer than the table granularity"},
+		{"month", "2024-01-15", "finer than the table granularity"},
+		{"month", "2024-06..2024-01", "end is before start"},
+		{"year", "2024..", "invalid period"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParsePeriods(tt.granularity, 0, tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParsePeriods(%q, %q) error = %v, want %q", tt.granularity, tt.spec, err, tt.wantErr)
+		}
+	}
+}
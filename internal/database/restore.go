@@ -0,0 +1,157 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/gorm"
+)
+
+// Restores run the archive flow in reverse: the archive database of a
+// table/period is read with the same batch loop and the rows are upserted
+// into the source table.
+
+// RestoreFilter narrows the archived rows that are restored
+type RestoreFilter struct {
+	From        time.Time // split_column >= From (zero = no lower bound)
+	To          time.Time // split_column < To (zero = no upper bound)
+	PrimaryKeys []string  // primary key values (single-column keys only)
+}
+
+// rowFilter builds the SQL condition of the filter for the table in db
+// (the archive or the source; quoting follows the connection's dialect)
+func (f *RestoreFilter) rowFilter(db *gorm.DB, table *types.Table) (*rowFilter, error) {
+	dialect := DialectOf(db)
+	var conditions []string
+	var args []interface{}
+
+	// From/To are encoded like period bounds, following the split_type
+	if (!f.From.IsZero() || !f.To.IsZero()) && table.SplitColumn == "" {
+		return nil, fmt.Errorf("--from/--to need a split_column; table %s takes its period from %s (restore the whole period instead)", table.Name, table.Parent.Parent.Name)
+	}
+	split, err := ParseSplitType(table)
+	if err != nil {
+		return nil, fmt.Errorf("table %s: %w", table.Name, err)
+	}
+	if !f.From.IsZero() {
+		conditions = append(conditions, dialect.QuoteIdent(table.SplitColumn)+" >= ?")
+		args = append(args, split.Bound(f.From))
+	}
+	if !f.To.IsZero() {
+		conditions = append(conditions, dialect.QuoteIdent(table.SplitColumn)+" < ?")
+		args = append(args, split.Bound(f.To))
+	}
+
+	if len(f.PrimaryKeys) > 0 {
+		keys, err := GetPrimaryKeyColumns(db, table.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get primary key of table %s: %w", table.Name, err)
+		}
+		if len(keys) != 1 {
+			return nil, fmt.Errorf("restoring by primary key requires a single-column primary key (table %s has %d key columns)", table.Name, len(keys))
+		}
+
+		placeholders := make([]string, len(f.PrimaryKeys))
+		for i, key := range f.PrimaryKeys {
+			placeholders[i] = "?"
+			args = append(args, primaryKeyArg(key))
+		}
+		conditions = append(conditions, fmt.Sprintf("%s IN (%s)", dialect.QuoteIdent(keys[0]), strings.Join(placeholders, ", ")))
+	}
+
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+	return &rowFilter{sql: strings.Join(conditions, " AND "), args: args}, nil
+}
+
+// primaryKeyArg binds numeric keys as integers so PostgreSQL compares them
+// with integer columns without a cast
+func primaryKeyArg(key string) interface{} {
+	if n, err := strconv.ParseInt(key, 10, 64); err == nil {
+		return n
+	}
+	return key
+}
+
+// CountRestorableRows returns how many archived rows match the filter
+func CountRestorableRows(archiveDB *gorm.DB, table *types.Table, period Period, filter *RestoreFilter) (int64, error) {
+	rf, err := filter.rowFilter(archiveDB, table)
+	if err != nil {
+		return 0, err
+	}
+	return countRows(archiveDB, table, period, rf)
+}
+
+// RestoreTableData upserts the archived rows of a table/period matching filter
+// back into the source table and returns how many rows were restored. The
+// source keeps its foreign keys, checks and triggers enforced unless
+// bypassConstraints is set.
+func RestoreTableData(sourceDB *gorm.DB, archiveDB *gorm.DB, table *types.Table, period Period, filter *RestoreFilter, bypassConstraints bool, config *types.ArchiveOptions) (int64, error) {
+	if resumesAt(config.Resume, table, period) {
+		return 0, fmt.Errorf("resume is not supported for restores")
+	}
+
+	rf, err := filter.rowFilter(archiveDB, table)
+	if err != nil {
+		return 0, err
+	}
+
+	// The source table defines the columns written back; the archive may
+	// use a different engine, in which case values are converted for the
+	// source driver
+	columns, err := GetTableColumns(sourceDB, table.Name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get columns for table %s: %w", table.Name, err)
+	}
+
+	var mapping *TableMapping
+	if DialectOf(sourceDB).Name() != DialectOf(archiveDB).Name() {
+		mapping, err = BuildTableMapping(archiveDB, DialectOf(sourceDB), table.Name)
+		if err != nil {
+			return 0, fmt.Errorf("failed to build type mapping for table %s: %w", table.Name, err)
+		}
+	}
+
+	insert, err := BuildMergeInsert(DialectOf(sourceDB), table.Name, columns)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build merge insert query: %w", err)
+	}
+
+	log.Printf("Restoring table %s, period %s from archive into source", table.Name, period)
+	if bypassConstraints {
+		log.Printf("WARNING: Restoring table %s with constraint checks (and PostgreSQL triggers) disabled", table.Name)
+	}
+	sink := &databaseSink{db: sourceDB, insert: insert, mapping: mapping, bypassConstraints: bypassConstraints}
+	return migrateToSink(archiveDB, sink, table, period, columns, rf, config)
+}
+
+// ValidateRestore checks that the source now holds at least as many rows
+// matching the filter as the archive
+func ValidateRestore(sourceDB *gorm.DB, archiveDB *gorm.DB, table *types.Table, period Period, filter *RestoreFilter) error {
+	archiveCount, err := CountRestorableRows(archiveDB, table, period, filter)
+	if err != nil {
+		return fmt.Errorf("failed to count archive rows: %w", err)
+	}
+
+	rf, err := filter.rowFilter(sourceDB, table)
+	if err != nil {
+		return err
+	}
+	sourceCount, err := countRows(sourceDB, table, period, rf)
+	if err != nil {
+		return fmt.Errorf("failed to count source rows: %w", err)
+	}
+
+	if sourceCount < archiveCount {
+		return fmt.Errorf("restore validation failed: archive has %d rows, source has %d rows (expected at least %d)", archiveCount, sourceCount, archiveCount)
+	}
+
+	log.Printf("Restore validation successful for table %s, period %s: archive=%d, source=%d rows", table.Name, period, archiveCount, sourceCount)
+	return nil
+}
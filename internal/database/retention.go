@@ -0,0 +1,271 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/gorm"
+)
+
+// Retention policies replace the fixed archive.years list: at run time the
+// policy is resolved into a cutoff, and every period of the table that ends
+// on or before the cutoff is archived.
+
+// retentionUnits maps the unit spellings accepted in a retention span
+var retentionUnits = map[string]string{
+	"d": "day", "day": "day", "days": "day",
+	"w": "week", "week": "week", "weeks": "week",
+	"month": "month", "months": "month",
+	"q": "quarter", "quarter": "quarter", "quarters": "quarter",
+	"y": "year", "year": "year", "years": "year",
+}
+
+// retentionSpan is a parsed retention length such as "540d" or "2 years"
+type retentionSpan struct {
+	n    int
+	unit string // day, week, month, quarter or year
+}
+
+func (s retentionSpan) String() string {
+	if s.n == 1 {
+		return fmt.Sprintf("1 %s", s.unit)
+	}
+	return fmt.Sprintf("%d %ss", s.n, s.unit)
+}
+
+// parseRetentionSpan parses "<n><unit>" or "<n> <unit>", e.g. 540d, 18 months
+func parseRetentionSpan(value string) (retentionSpan, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	digits := strings.IndexFunc(value, func(r rune) bool { return !unicode.IsDigit(r) })
+	if digits <= 0 {
+		return retentionSpan{}, fmt.Errorf("invalid length %q (expected e.g. 540d, 18 months or 2 years)", value)
+	}
+
+	n, err := strconv.Atoi(value[:digits])
+	unit, ok := retentionUnits[strings.TrimSpace(value[digits:])]
+	if err != nil || !ok || n <= 0 {
+		return retentionSpan{}, fmt.Errorf("invalid length %q (expected e.g. 540d, 18 months or 2 years)", value)
+	}
+	return retentionSpan{n: n, unit: unit}, nil
+}
+
+// subtract moves t back by n units of the span
+func (s retentionSpan) subtract(t time.Time, n int) time.Time {
+	switch s.unit {
+	case "day":
+		return t.AddDate(0, 0, -n)
+	case "week":
+		return t.AddDate(0, 0, -7*n)
+	case "month":
+		return t.AddDate(0, -n, 0)
+	case "quarter":
+		return t.AddDate(0, -3*n, 0)
+	default:
+		return t.AddDate(-n, 0, 0)
+	}
+}
+
+// truncate returns the start of the unit (day, Monday, month, quarter or
+// year) containing t; quarters and years follow the fiscal year start month
+func (s retentionSpan) truncate(t time.Time, fiscalYearStart int) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch s.unit {
+	case "day":
+		return day
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return day.AddDate(0, 0, 1-day.Day())
+	case "quarter":
+		return periodContaining(GranularityQuarter, fiscalYearStart, t).Start
+	default:
+		return periodContaining(GranularityYear, fiscalYearStart, t).Start
+	}
+}
+
+// ValidateRetention checks that exactly one of older_than and keep_last is
+// set and can be parsed
+func ValidateRetention(r *types.Retention) error {
+	if (r.OlderThan == "") == (r.KeepLast == "") {
+		return fmt.Errorf("exactly one of older_than and keep_last must be set")
+	}
+	if r.OlderThan != "" {
+		if _, err := parseRetentionSpan(r.OlderThan); err != nil {
+			return fmt.Errorf("older_than: %w", err)
+		}
+	}
+	if r.KeepLast != "" {
+		if _, err := parseRetentionSpan(r.KeepLast); err != nil {
+			return fmt.Errorf("keep_last: %w", err)
+		}
+	}
+	return nil
+}
+
+// RetentionPlan is a retention policy resolved against the clock and the
+// data of a table
+type RetentionPlan struct {
+	Policy   string    // e.g. "older_than 540 days"
+	TimeZone string    // business time zone the plan was resolved in
+	Now      time.Time // reference time (wall clock in TimeZone)
+	// Cutoff is the instant the policy asks to archive before
+	Cutoff time.Time
+	// ArchiveBefore is Cutoff rounded down to a period boundary: only whole
+	// periods are archived, so no row newer than Cutoff is touched
+	ArchiveBefore time.Time
+	// Periods lists every period from the oldest row up to ArchiveBefore
+	// (empty when the table holds nothing that old)
+	Periods []Period
+}
+
+// retentionCutoff resolves a retention policy at now
+func retentionCutoff(r *types.Retention, fiscalYearStart int, now time.Time) (string, time.Time, error) {
+	if r.OlderThan != "" {
+		span, err := parseRetentionSpan(r.OlderThan)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		return "older_than " + span.String(), span.subtract(now, span.n), nil
+	}
+
+	// keep_last N units keeps the current unit and the N-1 before it
+	span, err := parseRetentionSpan(r.KeepLast)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return "keep_last " + span.String(), span.subtract(span.truncate(now, fiscalYearStart), span.n-1), nil
+}
+
+// periodContaining returns the period of the given granularity containing
+// wall clock t
+func periodContaining(granularity string, fiscalYearStart int, t time.Time) Period {
+	year := FiscalYearPeriod(t.Year(), fiscalYearStart)
+	if fiscalYearStart > 1 && int(t.Month()) >= fiscalYearStart {
+		year = FiscalYearPeriod(t.Year()+1, fiscalYearStart)
+	}
+	for _, p := range year.split(normalizeGranularity(granularity)) {
+		if !t.Before(p.Start) && t.Before(p.End) {
+			return p
+		}
+	}
+	return year
+}
+
+// wallClock returns t's calendar date and time of day in the neutral
+// location used by Period
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// ResolveRetention resolves the retention policy of a table at now into a
+// cutoff and the periods to archive. The oldest split_column value of the
+// source table bounds the first period.
+func ResolveRetention(db *gorm.DB, table *types.Table, now time.Time) (*RetentionPlan, error) {
+	loc, err := LoadTimeZone(table.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	now = wallClock(now.In(loc))
+	policy, cutoff, err := retentionCutoff(table.Retention, table.FiscalYearStart, now)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retention for table %s: %w", table.Name, err)
+	}
+
+	plan := &RetentionPlan{Policy: policy, TimeZone: loc.String(), Now: now, Cutoff: cutoff}
+	plan.ArchiveBefore = periodContaining(table.Granularity, table.FiscalYearStart, cutoff).Start
+
+	oldest, ok, err := splitValue(db, table, "MIN")
+	if err != nil {
+		return nil, err
+	}
+	if !ok || !oldest.Before(plan.ArchiveBefore) {
+		return plan, nil
+	}
+
+	span := inFiscalYear(Period{Start: periodContaining(table.Granularity, table.FiscalYearStart, oldest).Start, End: plan.ArchiveBefore}, table.FiscalYearStart)
+	plan.Periods = span.split(normalizeGranularity(table.Granularity))
+	return plan, nil
+}
+
+// splitValue returns the MIN or MAX (aggregate) split_column value of a
+// table (for split_via, of its parent) as a wall clock in the business time
+// zone (ok is false when the table is empty)
+func splitValue(db *gorm.DB, table *types.Table, aggregate string) (time.Time, bool, error) {
+	table = splitSource(table)
+	dialect := DialectOf(db)
+	query := fmt.Sprintf("SELECT %s(%s) FROM %s", aggregate, dialect.QuoteIdent(table.SplitColumn), dialect.QuoteIdent(table.Name))
+
+	split, err := ParseSplitType(table)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("table %s: %w", table.Name, err)
+	}
+
+	var value interface{}
+	if err := db.Raw(query).Row().Scan(&value); err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to read %s(%s) of table %s: %w", aggregate, table.SplitColumn, table.Name, err)
+	}
+
+	t, ok, err := split.Time(value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to read %s(%s) of table %s: %w", aggregate, table.SplitColumn, table.Name, err)
+	}
+
+	// timestamptz values are instants; other date/time columns scan as wall
+	// clocks already
+	if _, scanned := value.(time.Time); scanned && ok {
+		col, err := splitColumnInfo(db, table)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		if ParseColumnType(col.Type).Kind == KindTimestampTZ {
+			t = t.In(split.location())
+		}
+	}
+	return wallClock(t), ok, nil
+}
+
+// scannedTime converts a scanned date/time value (time.Time, or text as
+// returned by SQLite for aggregates) to a time; text without an offset is
+// a wall clock in loc
+func scannedTime(value interface{}, loc *time.Location) (time.Time, bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return time.Time{}, false, nil
+	case time.Time:
+		return v, true, nil
+	case []byte:
+		return scannedTime(string(v), loc)
+	case string:
+		layouts := []string{
+			"2006-01-02 15:04:05.999999999-07:00",
+			"2006-01-02T15:04:05.999999999-07:00",
+			"2006-01-02 15:04:05.999999999",
+			"2006-01-02T15:04:05.999999999",
+			"2006-01-02",
+		}
+		for _, layout := range layouts {
+			if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+				return t.In(loc), true, nil
+			}
+		}
+		return time.Time{}, false, fmt.Errorf("cannot parse %q as a date", v)
+	default:
+		return time.Time{}, false, fmt.Errorf("unsupported value %v (%T) for a date column", value, value)
+	}
+}
+
+// Summary renders the plan on one line for logs and the PLAN output
+func (p *RetentionPlan) Summary() string {
+	periods := "none"
+	if n := len(p.Periods); n > 0 {
+		periods = fmt.Sprintf("%s..%s (%d)", p.Periods[0], p.Periods[n-1], n)
+	}
+	return fmt.Sprintf("policy=%q time_zone=%s now=%s cutoff=%s archive_before=%s periods=%s",
+		p.Policy, p.TimeZone, p.Now.Format("2006-01-02T15:04:05"), p.Cutoff.Format("2006-01-02T15:04:05"),
+		p.ArchiveBefore.Format("2006-01-02T15:04:05"), periods)
+}
@@ -5,32 +5,68 @@ import (
 	"log"
 	"strings"
 
+	"data-splitter/pkg/types"
+
 	"gorm.io/gorm"
 )
 
-// CreateArchiveDatabase creates the archive database if it doesn't exist
-func CreateArchiveDatabase(sourceDB *gorm.DB, archiveDBName string) error {
-	// Create database if it doesn't exist
-	createDBSQL := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", archiveDBName)
-	if err := sourceDB.Exec(createDBSQL).Error; err != nil {
-		return fmt.Errorf("failed to create archive database %s: %w", archiveDBName, err)
+// CreateArchiveDatabase creates the archive database on the archive server
+// if it doesn't exist. SQLite archive files only need their directory.
+func CreateArchiveDatabase(config *types.Database, archiveDBName string) error {
+	if IsSQLiteArchive(archiveDBName) {
+		return sqliteDialect{}.CreateDatabase(nil, archiveDBName)
 	}
 
-	log.Printf("Archive database %s created or already exists", archiveDBName)
-	return nil
+	serverDB, err := ConnectArchiveServer(config)
+	if err != nil {
+		return err
+	}
+	defer CloseConnection(serverDB)
+
+	return DialectOf(serverDB).CreateDatabase(serverDB, archiveDBName)
 }
 
 // GetTableSchema retrieves the CREATE TABLE statement for a source table
 func GetTableSchema(sourceDB *gorm.DB, tableName string) (string, error) {
-	var createTableSQL string
-	query := fmt.Sprintf("SHOW CREATE TABLE `%s`", tableName)
-	row := sourceDB.Raw(query).Row()
+	return DialectOf(sourceDB).GetTableSchema(sourceDB, tableName)
+}
+
+// GetArchiveTableSchema returns the CREATE TABLE statement to run on the
+// archive. When both sides use the same engine this is the source DDL;
+// otherwise the DDL is rendered from the cross-engine type mapping.
+func GetArchiveTableSchema(sourceDB *gorm.DB, archiveDB *gorm.DB, tableName string) (string, error) {
+	return archiveTableSchema(sourceDB, DialectOf(archiveDB), tableName)
+}
 
-	if err := row.Scan(&tableName, &createTableSQL); err != nil {
-		return "", fmt.Errorf("failed to get schema for table %s: %w", tableName, err)
+// archiveTableSchema is GetArchiveTableSchema for an archive dialect that
+// is not connected yet
+func archiveTableSchema(sourceDB *gorm.DB, archiveDialect Dialect, tableName string) (string, error) {
+	if DialectOf(sourceDB).Name() == archiveDialect.Name() {
+		return GetTableSchema(sourceDB, tableName)
 	}
 
-	return createTableSQL, nil
+	mapping, err := BuildTableMapping(sourceDB, archiveDialect, tableName)
+	if err != nil {
+		return "", err
+	}
+
+	return mapping.CreateTableSQL(archiveDialect), nil
+}
+
+// PlanTypeMapping returns the type mapping used to archive a table for a
+// year, or nil when the archive uses the same engine as the source. It does
+// not connect to the archive, so it is safe to call during a dry run.
+func PlanTypeMapping(sourceDB *gorm.DB, table *types.Table, period Period) (*TableMapping, error) {
+	archiveDialect, err := ArchiveDialect(table.ArchiveDatabase, BuildArchiveDBName(table.ArchivePattern, table.Name, period))
+	if err != nil {
+		return nil, err
+	}
+
+	if DialectOf(sourceDB).Name() == archiveDialect.Name() {
+		return nil, nil
+	}
+
+	return BuildTableMapping(sourceDB, archiveDialect, table.Name)
 }
 
 // CreateArchiveTable creates the table in the archive database or handles existing tables
@@ -57,24 +93,7 @@ func CreateArchiveTable(archiveDB *gorm.DB, createTableSQL string, tableName str
 
 // GetTableColumns retrieves column information for a table
 func GetTableColumns(db *gorm.DB, tableName string) ([]ColumnInfo, error) {
-	var columns []ColumnInfo
-	query := fmt.Sprintf("DESCRIBE `%s`", tableName)
-
-	rows, err := db.Raw(query).Rows()
-	if err != nil {
-		return nil, fmt.Errorf("failed to describe table %s: %w", tableName, err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var col ColumnInfo
-		if err := rows.Scan(&col.Field, &col.Type, &col.Null, &col.Key, &col.Default, &col.Extra); err != nil {
-			return nil, fmt.Errorf("failed to scan column info: %w", err)
-		}
-		columns = append(columns, col)
-	}
-
-	return columns, nil
+	return DialectOf(db).GetTableColumns(db, tableName)
 }
 
 // ColumnInfo represents column information from DESCRIBE
@@ -87,145 +106,254 @@ type ColumnInfo struct {
 	Extra   string
 }
 
-// BuildSelectQuery builds a SELECT query for data migration with NULLIF for text columns
-func BuildSelectQuery(tableName string, splitColumn string, year int, batchSize int, offset int) string {
-	query := fmt.Sprintf("SELECT * FROM `%s` WHERE YEAR(`%s`) = %d LIMIT %d OFFSET %d",
-		tableName, splitColumn, year, batchSize, offset)
-	return query
+// PeriodPredicate returns the half-open range selecting the rows of a
+// period, "col >= ? AND col < ?", with its bind values encoded for the
+// split type. Comparing the bare column (instead of YEAR(col) = N) lets the
+// engine use an index on it. Date/time columns are bound as date strings,
+// which SQLite compares with the stored text (its leading wall clock sorts
+// correctly).
+func PeriodPredicate(dialect Dialect, column string, period Period, split SplitType) (string, []interface{}) {
+	quoted := dialect.QuoteIdent(column)
+	return fmt.Sprintf("%s >= ? AND %s < ?", quoted, quoted),
+		[]interface{}{split.Bound(period.Start), split.Bound(period.End)}
+}
+
+// inlineArgs renders the bind values of a condition as literals, for
+// statements that are logged or written to scripts instead of executed
+func inlineArgs(dialect Dialect, condition string, args []interface{}) string {
+	// Split first so a ? inside an inlined string literal is left alone
+	parts := strings.SplitN(condition, "?", len(args)+1)
+	var b strings.Builder
+	for i, part := range parts {
+		b.WriteString(part)
+		if i < len(args) && i < len(parts)-1 {
+			b.WriteString(dialect.Literal(args[i], false))
+		}
+	}
+	return b.String()
 }
 
-// BuildSelectQueryWithColumns builds a SELECT query with NULLIF transformation for empty strings in text columns
-func BuildSelectQueryWithColumns(tableName string, splitColumn string, year int, batchSize int, offset int, columns []ColumnInfo) string {
+// selectColumnList renders the column list of a batch SELECT. With
+// emptyAsNull, empty text/blob values are selected as NULL for archive
+// databases; exports and restores keep the values as stored.
+func selectColumnList(dialect Dialect, columns []ColumnInfo, emptyAsNull bool) string {
 	var columnSelects []string
 
 	for _, col := range columns {
 		colType := strings.ToLower(col.Type)
+		column := dialect.QuoteIdent(col.Field)
 
 		// Apply NULLIF for text/longtext/mediumtext columns to convert empty strings to NULL
 		// This handles JSON validation constraints that don't allow empty strings
-		if strings.Contains(colType, "text") || strings.Contains(colType, "blob") {
-			columnSelects = append(columnSelects, fmt.Sprintf("NULLIF(`%s`, '') as `%s`", col.Field, col.Field))
+		if emptyAsNull && (strings.Contains(colType, "text") || strings.Contains(colType, "blob")) {
+			columnSelects = append(columnSelects, fmt.Sprintf("NULLIF(%s, '') as %s", column, column))
 		} else {
-			columnSelects = append(columnSelects, fmt.Sprintf("`%s`", col.Field))
+			columnSelects = append(columnSelects, column)
 		}
 	}
 
-	columnList := strings.Join(columnSelects, ", ")
-	query := fmt.Sprintf("SELECT %s FROM `%s` WHERE YEAR(`%s`) = %d LIMIT %d OFFSET %d",
-		columnList, tableName, splitColumn, year, batchSize, offset)
-
-	return query
+	return strings.Join(columnSelects, ", ")
 }
 
-// BuildInsertQuery builds an INSERT query for data migration
-func BuildInsertQuery(tableName string, columns []ColumnInfo) string {
-	var columnNames []string
-	var placeholders []string
+// rowFilter narrows the rows of a table/period read by the batch loop. sql is
+// ANDed to the period predicate and uses ? placeholders bound to args.
+type rowFilter struct {
+	sql  string
+	args []interface{}
+}
 
-	for _, col := range columns {
-		columnNames = append(columnNames, fmt.Sprintf("`%s`", col.Field))
-		placeholders = append(placeholders, "?")
+// and returns the filter narrowed by a further condition (either side may
+// be empty)
+func (f *rowFilter) and(sql string, args []interface{}) *rowFilter {
+	if f == nil || f.sql == "" {
+		return &rowFilter{sql: sql, args: args}
 	}
+	if sql == "" {
+		return f
+	}
+	return &rowFilter{
+		sql:  "(" + f.sql + ") AND " + sql,
+		args: append(append([]interface{}{}, f.args...), args...),
+	}
+}
 
-	query := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s)",
-		tableName,
-		strings.Join(columnNames, ", "),
-		strings.Join(placeholders, ", "))
-
-	return query
+// periodCondition returns the WHERE condition selecting the rows of a period
+// in db, narrowed by filter when set
+func periodCondition(db *gorm.DB, table *types.Table, period Period, filter *rowFilter) (string, []interface{}, error) {
+	condition, args, err := tablePeriodCondition(DialectOf(db), table, period)
+	if err != nil {
+		return "", nil, err
+	}
+	if filter == nil || filter.sql == "" {
+		return condition, args, nil
+	}
+	return condition + " AND (" + filter.sql + ")", append(args, filter.args...), nil
 }
 
-// GetRowCount gets the total number of rows for a specific year
-func GetRowCount(db *gorm.DB, tableName string, splitColumn string, year int) (int64, error) {
-	var count int64
-	query := fmt.Sprintf("SELECT COUNT(*) FROM `%s` WHERE YEAR(`%s`) = %d",
-		tableName, splitColumn, year)
+// tablePeriodCondition returns the condition selecting the rows of a period
+// of a table: the split column range (or, for a child, a semi-join to the
+// parent rows of the period) plus the table's where clause
+func tablePeriodCondition(dialect Dialect, table *types.Table, period Period) (string, []interface{}, error) {
+	cond, err := tableCondition(table)
+	if err != nil {
+		return "", nil, err
+	}
 
-	if err := db.Raw(query).Scan(&count).Error; err != nil {
-		return 0, fmt.Errorf("failed to count rows for table %s year %d: %w", tableName, year, err)
+	var condition string
+	var args []interface{}
+	if link := table.Parent; link != nil {
+		parentCondition, parentArgs, err := tablePeriodCondition(dialect, link.Parent, period)
+		if err != nil {
+			return "", nil, err
+		}
+		condition = fmt.Sprintf("%s IN (SELECT %s FROM %s WHERE %s)",
+			dialect.QuoteIdent(link.Key), dialect.QuoteIdent(link.ParentKey), dialect.QuoteIdent(link.Parent.Name), parentCondition)
+		args = parentArgs
+	} else {
+		split, err := ParseSplitType(table)
+		if err != nil {
+			return "", nil, fmt.Errorf("table %s: %w", table.Name, err)
+		}
+		condition, args = PeriodPredicate(dialect, table.SplitColumn, period, split)
+	}
+	if cond == nil {
+		return condition, args, nil
 	}
+	where, whereArgs := cond.SQL(dialect)
+	return condition + " AND " + where, append(args, whereArgs...), nil
+}
 
-	return count, nil
+// GetRowCount gets the total number of rows for a period
+func GetRowCount(db *gorm.DB, table *types.Table, period Period) (int64, error) {
+	return countRows(db, table, period, nil)
 }
 
-// CheckTableExists checks if a table exists in the database
-func CheckTableExists(db *gorm.DB, tableName string) (bool, error) {
-	var count int64
-	query := fmt.Sprintf("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = '%s'", tableName)
+// countRows counts the rows of a period matching filter (nil = all rows)
+func countRows(db *gorm.DB, table *types.Table, period Period, filter *rowFilter) (int64, error) {
+	condition, args, err := periodCondition(db, table, period, filter)
+	if err != nil {
+		return 0, err
+	}
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", DialectOf(db).QuoteIdent(table.Name), condition)
 
-	if err := db.Raw(query).Scan(&count).Error; err != nil {
-		return false, fmt.Errorf("failed to check if table %s exists: %w", tableName, err)
+	var count int64
+	if err := db.Raw(query, args...).Scan(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count rows for table %s period %s: %w", table.Name, period, err)
 	}
 
-	return count > 0, nil
+	return count, nil
 }
 
-// CompareTableSchemas compares source and archive table schemas
-func CompareTableSchemas(sourceDB *gorm.DB, archiveDB *gorm.DB, tableName string) (bool, error) {
-	// Get source table schema
-	sourceSchema, err := GetTableSchema(sourceDB, tableName)
+// hasRows reports whether a table has any row in a period, without counting
+// them all
+func hasRows(db *gorm.DB, table *types.Table, period Period) (bool, error) {
+	condition, args, err := periodCondition(db, table, period, nil)
 	if err != nil {
-		return false, fmt.Errorf("failed to get source schema: %w", err)
+		return false, err
 	}
+	query := fmt.Sprintf("SELECT 1 FROM %s WHERE %s LIMIT 1", DialectOf(db).QuoteIdent(table.Name), condition)
 
-	// Get archive table schema
-	archiveSchema, err := GetTableSchema(archiveDB, tableName)
-	if err != nil {
-		return false, fmt.Errorf("failed to get archive schema: %w", err)
+	var found []int64
+	if err := db.Raw(query, args...).Scan(&found).Error; err != nil {
+		return false, fmt.Errorf("failed to look for rows of table %s period %s: %w", table.Name, period, err)
 	}
+	return len(found) > 0, nil
+}
 
-	// For now, do a simple string comparison
-	// In production, you might want more sophisticated schema comparison
-	return sourceSchema == archiveSchema, nil
+// CheckTableExists checks if a table exists in the database
+func CheckTableExists(db *gorm.DB, tableName string) (bool, error) {
+	return DialectOf(db).TableExists(db, tableName)
 }
 
 // GetPrimaryKeyColumns gets the primary key columns for a table
 func GetPrimaryKeyColumns(db *gorm.DB, tableName string) ([]string, error) {
-	var primaryKeys []string
-	query := fmt.Sprintf("SHOW KEYS FROM `%s` WHERE Key_name = 'PRIMARY'", tableName)
-
-	rows, err := db.Raw(query).Rows()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get primary keys for table %s: %w", tableName, err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var table, nonUnique, keyName, seqInIndex, columnName, collation, cardinality, subPart, packed, null, indexType, comment, indexComment string
-		var filtered int
-		if err := rows.Scan(&table, &nonUnique, &keyName, &seqInIndex, &columnName, &collation, &cardinality, &subPart, &packed, &null, &indexType, &comment, &indexComment, &filtered); err != nil {
-			return nil, fmt.Errorf("failed to scan primary key info: %w", err)
-		}
-		primaryKeys = append(primaryKeys, columnName)
-	}
+	return DialectOf(db).GetPrimaryKeyColumns(db, tableName)
+}
 
-	return primaryKeys, nil
+// MergeInsert builds INSERT statements carrying one or more rows, with the
+// dialect's upsert clause (ON DUPLICATE KEY UPDATE, ON CONFLICT ...) for data
+// migration
+type MergeInsert struct {
+	dialect Dialect
+	head    string // INSERT INTO table (columns) VALUES
+	upsert  string
+	columns int
 }
 
-// BuildMergeInsertQuery builds an INSERT ... ON DUPLICATE KEY UPDATE query for data migration
-func BuildMergeInsertQuery(tableName string, columns []ColumnInfo) (string, error) {
+// BuildMergeInsert prepares the merge insert of the given columns
+func BuildMergeInsert(dialect Dialect, tableName string, columns []ColumnInfo) (*MergeInsert, error) {
 	var columnNames []string
-	var placeholders []string
-	var updateParts []string
+	var keyColumns []string
+	var updateColumns []string
 
 	for _, col := range columns {
-		columnNames = append(columnNames, fmt.Sprintf("`%s`", col.Field))
-		placeholders = append(placeholders, "?")
+		column := dialect.QuoteIdent(col.Field)
+		columnNames = append(columnNames, column)
 		// For merge, update all non-primary key columns
 		// Note: This assumes we want to overwrite existing data
-		if col.Key != "PRI" {
-			updateParts = append(updateParts, fmt.Sprintf("`%s` = VALUES(`%s`)", col.Field, col.Field))
+		if col.Key == "PRI" {
+			keyColumns = append(keyColumns, column)
+		} else {
+			updateColumns = append(updateColumns, column)
 		}
 	}
+	if len(columnNames) == 0 {
+		return nil, fmt.Errorf("table %s has no columns", tableName)
+	}
 
-	query := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s)",
-		tableName,
-		strings.Join(columnNames, ", "),
-		strings.Join(placeholders, ", "))
+	return &MergeInsert{
+		dialect: dialect,
+		head:    fmt.Sprintf("INSERT INTO %s (%s) VALUES ", dialect.QuoteIdent(tableName), strings.Join(columnNames, ", ")),
+		upsert:  dialect.UpsertClause(keyColumns, updateColumns),
+		columns: len(columns),
+	}, nil
+}
 
-	if len(updateParts) > 0 {
-		query += " ON DUPLICATE KEY UPDATE " + strings.Join(updateParts, ", ")
+// Query returns the statement inserting the given number of rows; the
+// arguments are the row values one row after another
+func (m *MergeInsert) Query(rows int) string {
+	var b strings.Builder
+	b.WriteString(m.head)
+	n := 0
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for column := 0; column < m.columns; column++ {
+			if column > 0 {
+				b.WriteString(", ")
+			}
+			n++
+			b.WriteString(m.dialect.Placeholder(n))
+		}
+		b.WriteByte(')')
 	}
+	b.WriteString(m.upsert)
+	return b.String()
+}
+
+// rowSize estimates the bytes one row adds to a statement sent to the
+// server: its placeholders plus its values, strings counted as if every
+// byte were escaped
+func (m *MergeInsert) rowSize(values []interface{}) int {
+	size := 4 + 6*m.columns
+	for _, v := range values {
+		switch x := v.(type) {
+		case nil:
+			size += 4
+		case []byte:
+			size += 2*len(x) + 3
+		case string:
+			size += 2*len(x) + 3
+		default:
+			size += 32
+		}
+	}
+	return size
+}
 
-	return query, nil
+// fixedSize is the size of a statement apart from its rows
+func (m *MergeInsert) fixedSize() int {
+	return len(m.head) + len(m.upsert)
 }
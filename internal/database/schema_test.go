@@ -0,0 +1,122 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPeriodPredicate(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*3600)
+	clamped := YearPeriod(2026)
+	clamped.End = time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		dialect  Dialect
+		period   Period
+		split    SplitType
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "datetime year",
+			dialect:  mysqlDialect{},
+			period:   YearPeriod(2024),
+			wantSQL:  "`created_at` >= ? AND `created_at` < ?",
+			wantArgs: []interface{}{"2024-01-01", "2025-01-01"},
+		},
+		{
+			name:     "fiscal year",
+			dialect:  postgresDialect{},
+			period:   FiscalYearPeriod(2025, 4),
+			wantSQL:  `"created_at" >= ? AND "created_at" < ?`,
+			wantArgs: []interface{}{"2024-04-01", "2025-04-01"},
+		},
+		{
+			name:     "month across a year end",
+			dialect:  sqliteDialect{},
+			period:   newPeriod(GranularityMonth, date(2024, 12, 1)),
+			wantSQL:  `"created_at" >= ? AND "created_at" < ?`,
+			wantArgs: []interface{}{"2024-12-01", "2025-01-01"},
+		},
+		{
+			name:     "period clamped to a cutoff",
+			dialect:  mysqlDialect{},
+			period:   clamped,
+			wantSQL:  "`created_at` >= ? AND `created_at` < ?",
+			wantArgs: []interface{}{"2026-01-01", "2026-10-16 12:00:00"},
+		},
+		{
+			name:     "epoch seconds in UTC",
+			dialect:  mysqlDialect{},
+			period:   YearPeriod(2024),
+			split:    SplitType{Kind: SplitEpochSecond},
+			wantSQL:  "`created_at` >= ? AND `created_at` < ?",
+			wantArgs: []interface{}{int64(1704067200), int64(1735689600)},
+		},
+		{
+			name:     "epoch milliseconds in the business time zone",
+			dialect:  mysqlDialect{},
+			period:   YearPeriod(2024),
+			split:    SplitType{Kind: SplitEpochMilli, loc: jakarta},
+			wantSQL:  "`created_at` >= ? AND `created_at` < ?",
+			wantArgs: []interface{}{int64(1704042000000), int64(1735664400000)},
+		},
+		{
+			name:     "string format",
+			dialect:  mysqlDialect{},
+			period:   newPeriod(GranularityMonth, date(2024, 3, 1)),
+			split:    SplitType{Kind: SplitString, Format: "YYYYMMDD", layout: "20060102"},
+			wantSQL:  "`created_at` >= ? AND `created_at` < ?",
+			wantArgs: []interface{}{"20240301", "20240401"},
+		},
+	}
+
+	for _, tt := range tests {
+		sql, args := PeriodPredicate(tt.dialect, "created_at", tt.period, tt.split)
+		if sql != tt.wantSQL {
+			t.Errorf("%s: sql = %q, want %q", tt.name, sql, tt.wantSQL)
+		}
+		if !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("%s: args = %#v, want %#v", tt.name, args, tt.wantArgs)
+		}
+	}
+}
+
+// Consecutive periods must share their boundary so no row is selected by
+// two periods or by none
+func TestPeriodPredicateHalfOpen(t *testing.T) {
+	periods, err := ParsePeriods(GranularityMonth, 0, "2024-01..2024-12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(periods); i++ {
+		_, prev := PeriodPredicate(mysqlDialect{}, "created_at", periods[i-1], SplitType{})
+		_, next := PeriodPredicate(mysqlDialect{}, "created_at", periods[i], SplitType{})
+		if prev[1] != next[0] {
+			t.Errorf("%s ends at %v but %s starts at %v", periods[i-1], prev[1], periods[i], next[0])
+		}
+	}
+}
+
+func TestInlineArgs(t *testing.T) {
+	condition := "`status` = ? AND `created_at` >= ?"
+	got := inlineArgs(mysqlDialect{}, condition, []interface{}{"what?", "2024-01-01"})
+	want := "`status` = 'what?' AND `created_at` >= '2024-01-01'"
+	if got != want {
+		t.Errorf("inlineArgs = %q, want %q", got, want)
+	}
+}
+
+func TestSelectColumnList(t *testing.T) {
+	columns := []ColumnInfo{{Field: "id", Type: "bigint"}, {Field: "note", Type: "mediumtext"}, {Field: "data", Type: "BLOB"}}
+
+	if got, want := selectColumnList(mysqlDialect{}, columns, true), "`id`, NULLIF(`note`, '') as `note`, NULLIF(`data`, '') as `data`"; got != want {
+		t.Errorf("archive columns = %q, want %q", got, want)
+	}
+	// Exports and restores keep empty strings
+	if got, want := selectColumnList(postgresDialect{}, columns, false), `"id", "note", "data"`; got != want {
+		t.Errorf("plain columns = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,462 @@
+package database
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/gorm"
+)
+
+// Review mode writes the statements of a table/period archive to numbered SQL
+// files instead of executing them, so a DBA can review and apply them by
+// hand. The only statements run are reads on the source (row counts, chunk
+// boundaries and, when the archive is not on the source server, the rows
+// themselves, which are rendered as INSERT statements).
+
+// ArchiveScripts lists the files written for one table/period
+type ArchiveScripts struct {
+	Dir   string
+	Files []string
+}
+
+// scriptWriter writes one SQL file with a guard header
+type scriptWriter struct {
+	file *os.File
+	w    *bufio.Writer
+	path string
+}
+
+func newScriptWriter(dir, name, title, target string) (*scriptWriter, error) {
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create script %s: %w", path, err)
+	}
+
+	sw := &scriptWriter{file: file, w: bufio.NewWriter(file), path: path}
+	sw.comment("%s", title)
+	sw.comment("Generated by data-splitter at %s for DBA review. Nothing in this file has been executed.", time.Now().Format(time.RFC3339))
+	sw.comment("Run against: %s", target)
+	sw.line("")
+	return sw, nil
+}
+
+func (sw *scriptWriter) comment(format string, args ...interface{}) {
+	for _, line := range strings.Split(fmt.Sprintf(format, args...), "\n") {
+		sw.w.WriteString("-- " + line + "\n")
+	}
+}
+
+func (sw *scriptWriter) line(s string) {
+	sw.w.WriteString(s + "\n")
+}
+
+func (sw *scriptWriter) statement(s string) {
+	sw.w.WriteString(s + ";\n")
+}
+
+func (sw *scriptWriter) close() error {
+	if err := sw.w.Flush(); err != nil {
+		sw.file.Close()
+		return fmt.Errorf("failed to write script %s: %w", sw.path, err)
+	}
+	if err := sw.file.Close(); err != nil {
+		return fmt.Errorf("failed to close script %s: %w", sw.path, err)
+	}
+	return nil
+}
+
+// describeServer names a server for the "Run against" header
+func describeServer(config *types.Database, database string) string {
+	port := config.Port
+	if port == 0 {
+		if strings.HasPrefix(config.Type, "postgres") || config.Type == "pgsql" {
+			port = 5432
+		} else {
+			port = 3306
+		}
+	}
+	if database == "" {
+		return fmt.Sprintf("%s server %s:%d", config.Type, config.Host, port)
+	}
+	return fmt.Sprintf("database %s on %s server %s:%d", database, config.Type, config.Host, port)
+}
+
+// WriteArchiveScripts writes the scripts archiving a table/period into
+// dir/{table}_{period}:
+//
+//	01_create_database.sql  CREATE DATABASE on the archive server
+//	02_create_table.sql     CREATE TABLE in the archive database
+//	03_copy.sql             chunked INSERT ... SELECT when the archive is a
+//	                        MySQL database on the source server, otherwise
+//	                        INSERT statements holding the exported rows
+//	04_verify.sql           row counts to compare before deleting
+//	05_delete.sql           chunked DELETE from the source (only with
+//	                        delete_after_archive)
+func WriteArchiveScripts(sourceDB *gorm.DB, source *types.Database, table *types.Table, period Period, dir string, options *types.ArchiveOptions) (*ArchiveScripts, error) {
+	archiveName := BuildArchiveDBName(table.ArchivePattern, table.Name, period)
+	archiveDialect, err := ArchiveDialect(table.ArchiveDatabase, archiveName)
+	if err != nil {
+		return nil, err
+	}
+	sourceDialect := DialectOf(sourceDB)
+
+	scripts := &ArchiveScripts{Dir: filepath.Join(dir, fmt.Sprintf("%s_%s", table.Name, period))}
+	if err := os.MkdirAll(scripts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create script directory %s: %w", scripts.Dir, err)
+	}
+
+	totalRows, err := GetRowCount(sourceDB, table, period)
+	if err != nil {
+		return nil, err
+	}
+
+	// Scripts carry the period range (and the table's where) as literals
+	if _, _, err := tablePeriodCondition(sourceDialect, table, period); err != nil {
+		return nil, err
+	}
+	periodSQL := func(dialect Dialect) string {
+		condition, args, _ := tablePeriodCondition(dialect, table, period)
+		return inlineArgs(dialect, condition, args)
+	}
+
+	archiveTarget := describeServer(table.ArchiveDatabase, archiveName)
+	if IsSQLiteArchive(archiveName) {
+		archiveTarget = "SQLite file " + archiveName
+	}
+	sourceTarget := describeServer(source, source.SourceDB)
+
+	// Chunk boundaries on a single-column primary key keep every INSERT
+	// and DELETE statement bounded; composite keys fall back to a single
+	// statement per step
+	keys, err := GetPrimaryKeyColumns(sourceDB, table.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get primary key of table %s: %w", table.Name, err)
+	}
+	var chunks []keyChunk
+	if len(keys) == 1 && totalRows > 0 {
+		chunks, err = keyChunks(sourceDB, table, periodSQL(sourceDialect), keys[0], options.BatchSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 01: archive database
+	sw, err := newScriptWriter(scripts.Dir, "01_create_database.sql", fmt.Sprintf("Step 1/5: create archive database for %s period %s", table.Name, period), describeServer(table.ArchiveDatabase, ""))
+	if err != nil {
+		return nil, err
+	}
+	if createSQL := archiveDialect.CreateDatabaseSQL(archiveName); createSQL != "" {
+		if archiveDialect.Name() == "postgres" {
+			sw.comment("PostgreSQL has no CREATE DATABASE IF NOT EXISTS: skip this statement if the database exists.")
+		}
+		sw.statement(createSQL)
+	} else {
+		sw.comment("Nothing to run: the SQLite file %s is created when it is first opened.", archiveName)
+	}
+	if err := sw.close(); err != nil {
+		return nil, err
+	}
+	scripts.Files = append(scripts.Files, sw.path)
+
+	// 02: archive table
+	schema, err := archiveTableSchema(sourceDB, archiveDialect, table.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get table schema: %w", err)
+	}
+	sw, err = newScriptWriter(scripts.Dir, "02_create_table.sql", fmt.Sprintf("Step 2/5: create table %s in the archive", table.Name), archiveTarget)
+	if err != nil {
+		return nil, err
+	}
+	sw.statement(createTableIfNotExists(strings.TrimSpace(schema)))
+	if err := sw.close(); err != nil {
+		return nil, err
+	}
+	scripts.Files = append(scripts.Files, sw.path)
+
+	// 03: copy rows
+	sameServer := sourceDialect.Name() == "mysql" && archiveDialect.Name() == "mysql" &&
+		table.ArchiveDatabase.Host == source.Host && table.ArchiveDatabase.Port == source.Port
+	copyTarget := archiveTarget
+	if sameServer {
+		copyTarget = sourceTarget
+	}
+	sw, err = newScriptWriter(scripts.Dir, "03_copy.sql", fmt.Sprintf("Step 3/5: copy %d rows of %s period %s into the archive", totalRows, table.Name, period), copyTarget)
+	if err != nil {
+		return nil, err
+	}
+	sw.comment("GUARD: run only after steps 1 and 2 succeeded. Statements upsert, so re-running is safe.")
+	sw.line("")
+	if sameServer {
+		err = writeInsertSelect(sw, sourceDB, source.SourceDB, archiveName, table, periodSQL(sourceDialect), keys, chunks)
+	} else {
+		err = writeDataInserts(sw, sourceDB, archiveDialect, table, period, options)
+	}
+	if err != nil {
+		sw.close()
+		return nil, err
+	}
+	if err := sw.close(); err != nil {
+		return nil, err
+	}
+	scripts.Files = append(scripts.Files, sw.path)
+
+	// 04: verification
+	sw, err = newScriptWriter(scripts.Dir, "04_verify.sql", fmt.Sprintf("Step 4/5: verify %s period %s", table.Name, period), "source and archive (see comments)")
+	if err != nil {
+		return nil, err
+	}
+	sw.comment("At generation time the source held %d rows for %s.", totalRows, period)
+	sw.comment("The archive count must be at least the source count before step 5 is run.")
+	sw.line("")
+	sw.comment("On %s:", sourceTarget)
+	sw.statement(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", sourceDialect.QuoteIdent(table.Name), periodSQL(sourceDialect)))
+	sw.line("")
+	sw.comment("On %s:", archiveTarget)
+	sw.statement(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", archiveDialect.QuoteIdent(table.Name), periodSQL(archiveDialect)))
+	if err := sw.close(); err != nil {
+		return nil, err
+	}
+	scripts.Files = append(scripts.Files, sw.path)
+
+	// 05: delete from source
+	if !options.DeleteAfterArchive {
+		log.Printf("Skipping delete script for table %s, period %s (delete_after_archive is false)", table.Name, period)
+		return scripts, nil
+	}
+	sw, err = newScriptWriter(scripts.Dir, "05_delete.sql", fmt.Sprintf("Step 5/5: delete %d archived rows of %s period %s from the source", totalRows, table.Name, period), sourceTarget)
+	if err != nil {
+		return nil, err
+	}
+	sw.comment("GUARD: DESTRUCTIVE. Run only after step 3 completed without errors and step 4")
+	sw.comment("shows an archive count >= the source count. Take a backup first.")
+	sw.line("")
+	writeDeletes(sw, sourceDialect, table, periodSQL(sourceDialect), keys, chunks)
+	if err := sw.close(); err != nil {
+		return nil, err
+	}
+	scripts.Files = append(scripts.Files, sw.path)
+
+	return scripts, nil
+}
+
+// keyChunk bounds one chunk of a single-column primary key: lower < key <= upper
+// (no lower bound for the first chunk)
+type keyChunk struct {
+	lower interface{}
+	upper interface{}
+	first bool
+}
+
+// keyChunks splits the rows of a table/period (selected by the
+// periodCondition) into chunks of size rows, ordered by the primary key column
+func keyChunks(db *gorm.DB, table *types.Table, periodCondition string, key string, size int) ([]keyChunk, error) {
+	if size <= 0 {
+		size = 1000
+	}
+	dialect := DialectOf(db)
+	quotedKey := dialect.QuoteIdent(key)
+	base := fmt.Sprintf("FROM %s WHERE %s", dialect.QuoteIdent(table.Name), periodCondition)
+
+	var chunks []keyChunk
+	var lower interface{}
+	for {
+		condition, args := "", []interface{}{}
+		if len(chunks) > 0 {
+			condition, args = fmt.Sprintf(" AND %s > ?", quotedKey), []interface{}{lower}
+		}
+
+		var upper interface{}
+		query := fmt.Sprintf("SELECT %s %s%s ORDER BY %s LIMIT 1 OFFSET %d", quotedKey, base, condition, quotedKey, size-1)
+		rows, err := db.Raw(query, args...).Rows()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute chunk boundaries: %w", err)
+		}
+		found := rows.Next()
+		if found {
+			err = rows.Scan(&upper)
+		}
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute chunk boundaries: %w", err)
+		}
+
+		if !found {
+			// Last (partial) chunk ends at the largest key
+			query = fmt.Sprintf("SELECT MAX(%s) %s%s", quotedKey, base, condition)
+			if err := db.Raw(query, args...).Row().Scan(&upper); err != nil {
+				return nil, fmt.Errorf("failed to compute chunk boundaries: %w", err)
+			}
+			if upper != nil {
+				chunks = append(chunks, keyChunk{lower: lower, upper: upper, first: len(chunks) == 0})
+			}
+			return chunks, nil
+		}
+
+		chunks = append(chunks, keyChunk{lower: lower, upper: upper, first: len(chunks) == 0})
+		lower = upper
+	}
+}
+
+// predicate renders the chunk bounds for dialect
+func (c keyChunk) predicate(dialect Dialect, key string) string {
+	quotedKey := dialect.QuoteIdent(key)
+	upper := fmt.Sprintf("%s <= %s", quotedKey, dialect.Literal(c.upper, false))
+	if c.first {
+		return upper
+	}
+	return fmt.Sprintf("%s > %s AND %s", quotedKey, dialect.Literal(c.lower, false), upper)
+}
+
+// writeInsertSelect writes chunked INSERT ... SELECT statements copying rows
+// between two databases on the same MySQL server
+func writeInsertSelect(sw *scriptWriter, sourceDB *gorm.DB, sourceName, archiveName string, table *types.Table, periodCondition string, keys []string, chunks []keyChunk) error {
+	dialect := DialectOf(sourceDB)
+	columns, err := GetTableColumns(sourceDB, table.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get columns for table %s: %w", table.Name, err)
+	}
+
+	var names, keyColumns, updateColumns []string
+	for _, col := range columns {
+		name := dialect.QuoteIdent(col.Field)
+		names = append(names, name)
+		if col.Key == "PRI" {
+			keyColumns = append(keyColumns, name)
+		} else {
+			updateColumns = append(updateColumns, name)
+		}
+	}
+	columnList := strings.Join(names, ", ")
+
+	prefix := fmt.Sprintf("INSERT INTO %s.%s (%s) SELECT %s FROM %s.%s WHERE %s",
+		dialect.QuoteIdent(archiveName), dialect.QuoteIdent(table.Name), columnList,
+		columnList, dialect.QuoteIdent(sourceName), dialect.QuoteIdent(table.Name),
+		periodCondition)
+	upsert := dialect.UpsertClause(keyColumns, updateColumns)
+
+	if len(chunks) == 0 {
+		if len(keys) != 1 {
+			sw.comment("Single statement: chunking needs a single-column primary key.")
+		}
+		sw.statement(prefix + upsert)
+		return nil
+	}
+
+	for i, chunk := range chunks {
+		sw.comment("Chunk %d/%d", i+1, len(chunks))
+		sw.statement(prefix + " AND " + chunk.predicate(dialect, keys[0]) + upsert)
+	}
+	return nil
+}
+
+// writeDeletes writes the chunked DELETE statements for the source
+func writeDeletes(sw *scriptWriter, dialect Dialect, table *types.Table, periodCondition string, keys []string, chunks []keyChunk) {
+	prefix := fmt.Sprintf("DELETE FROM %s WHERE %s", dialect.QuoteIdent(table.Name), periodCondition)
+
+	if len(chunks) == 0 {
+		sw.statement(prefix)
+		return
+	}
+
+	for i, chunk := range chunks {
+		sw.comment("Chunk %d/%d", i+1, len(chunks))
+		sw.statement(prefix + " AND " + chunk.predicate(dialect, keys[0]))
+	}
+}
+
+// writeDataInserts exports the rows of a table/period as multi-row INSERT
+// statements for the archive, using the regular batch loop
+func writeDataInserts(sw *scriptWriter, sourceDB *gorm.DB, archiveDialect Dialect, table *types.Table, period Period, options *types.ArchiveOptions) error {
+	columns, err := GetTableColumns(sourceDB, table.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get columns for table %s: %w", table.Name, err)
+	}
+
+	var mapping *TableMapping
+	if DialectOf(sourceDB).Name() != archiveDialect.Name() {
+		mapping, err = BuildTableMapping(sourceDB, archiveDialect, table.Name)
+		if err != nil {
+			return fmt.Errorf("failed to build type mapping for table %s: %w", table.Name, err)
+		}
+	}
+
+	sink := newScriptSink(sw, archiveDialect, table.Name, columns, mapping)
+	sw.comment("Rows exported from the source; one INSERT per batch of %d rows.", options.BatchSize)
+
+	scriptOptions := *options
+	scriptOptions.Resume = nil
+	_, err = migrateToSink(sourceDB, sink, table, period, columns, nil, &scriptOptions)
+	return err
+}
+
+// scriptSink renders batches as multi-row INSERT statements
+type scriptSink struct {
+	sw      *scriptWriter
+	dialect Dialect
+	prefix  string
+	upsert  string
+	binary  []bool
+	mapping *TableMapping
+}
+
+func newScriptSink(sw *scriptWriter, dialect Dialect, tableName string, columns []ColumnInfo, mapping *TableMapping) *scriptSink {
+	var names, keyColumns, updateColumns []string
+	binary := make([]bool, len(columns))
+	for i, col := range columns {
+		name := dialect.QuoteIdent(col.Field)
+		names = append(names, name)
+		if col.Key == "PRI" {
+			keyColumns = append(keyColumns, name)
+		} else {
+			updateColumns = append(updateColumns, name)
+		}
+		binary[i] = ParseColumnType(col.Type).Kind == KindBinary
+	}
+
+	return &scriptSink{
+		sw:      sw,
+		dialect: dialect,
+		prefix:  fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", dialect.QuoteIdent(tableName), strings.Join(names, ", ")),
+		upsert:  dialect.UpsertClause(keyColumns, updateColumns),
+		binary:  binary,
+		mapping: mapping,
+	}
+}
+
+// emptyTextAsNull: scripts load an archive database, like MigrateTableData
+func (s *scriptSink) emptyTextAsNull() bool { return true }
+
+func (s *scriptSink) WriteBatch(rows [][]interface{}) (int64, error) {
+	tuples := make([]string, len(rows))
+	literals := make([]string, len(s.binary))
+	for i, values := range rows {
+		if s.mapping != nil {
+			s.mapping.ConvertRow(values)
+		}
+		for j, v := range values {
+			literals[j] = s.dialect.Literal(v, s.binary[j])
+		}
+		tuples[i] = "  (" + strings.Join(literals, ", ") + ")"
+	}
+
+	s.sw.statement(s.prefix + strings.Join(tuples, ",\n") + s.upsert)
+	return int64(len(rows)), nil
+}
+
+// createTableIfNotExists makes the CREATE TABLE statement safe to re-run;
+// all supported engines accept IF NOT EXISTS
+func createTableIfNotExists(schema string) string {
+	const prefix = "CREATE TABLE "
+	if strings.HasPrefix(strings.ToUpper(schema), prefix) && !strings.HasPrefix(strings.ToUpper(schema), prefix+"IF NOT EXISTS") {
+		return prefix + "IF NOT EXISTS " + schema[len(prefix):]
+	}
+	return schema
+}
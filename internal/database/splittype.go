@@ -0,0 +1,278 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/gorm"
+)
+
+// Split types accepted by table.split_type
+const (
+	SplitDatetime    = "datetime"
+	SplitEpochSecond = "epoch_s"
+	SplitEpochMilli  = "epoch_ms"
+	SplitString      = "string"
+)
+
+// SplitType describes how split_column stores a point in time, which
+// decides how period boundaries are encoded in range predicates. The zero
+// value is a DATE/DATETIME column.
+type SplitType struct {
+	Kind   string         // one of the Split* constants ("" means datetime)
+	Format string         // split_format of string columns, e.g. YYYYMMDD
+	layout string         // Format as a Go time layout
+	finest string         // finest granularity Format can express
+	loc    *time.Location // business time zone of the boundaries (nil = UTC)
+}
+
+// splitFormatTokens maps split_format tokens to Go layout elements, from the
+// most to the least significant; they must appear in this order so that
+// formatted values sort like the times they encode
+var splitFormatTokens = []struct {
+	token       string
+	layout      string
+	granularity string // finest granularity the format can express with it
+}{
+	{"YYYY", "2006", GranularityYear},
+	{"MM", "01", GranularityMonth},
+	{"DD", "02", GranularityDay},
+	{"HH", "15", ""},
+	{"mm", "04", ""},
+	{"ss", "05", ""},
+}
+
+// ParseSplitType returns the split type configured for a table
+func ParseSplitType(table *types.Table) (SplitType, error) {
+	loc, err := LoadTimeZone(table.TimeZone)
+	if err != nil {
+		return SplitType{}, err
+	}
+
+	kind := strings.ToLower(strings.TrimSpace(table.SplitType))
+	switch kind {
+	case "", SplitDatetime, SplitEpochSecond, SplitEpochMilli:
+		if table.SplitFormat != "" {
+			return SplitType{}, fmt.Errorf("split_format is only used with split_type %s", SplitString)
+		}
+		return SplitType{Kind: kind, loc: loc}, nil
+	case SplitString:
+		layout, finest, err := splitLayout(table.SplitFormat)
+		if err != nil {
+			return SplitType{}, err
+		}
+		return SplitType{Kind: kind, Format: table.SplitFormat, layout: layout, finest: finest, loc: loc}, nil
+	default:
+		return SplitType{}, fmt.Errorf("invalid split_type %q (expected %s, %s, %s or %s)", table.SplitType, SplitDatetime, SplitEpochSecond, SplitEpochMilli, SplitString)
+	}
+}
+
+// splitLayout converts a split_format such as YYYYMMDD or
+// "YYYY-MM-DD HH:mm:ss" to a Go layout. Fields must run from year down to
+// seconds so that string comparison matches time order. It also returns the
+// finest granularity the format can express.
+func splitLayout(format string) (string, string, error) {
+	if format == "" {
+		return "", "", fmt.Errorf("split_format is required for split_type %s (e.g. YYYYMMDD)", SplitString)
+	}
+
+	var layout strings.Builder
+	finest := GranularityYear
+	next := 0
+	for rest := format; rest != ""; {
+		matched := false
+		for i, t := range splitFormatTokens {
+			if !strings.HasPrefix(rest, t.token) {
+				continue
+			}
+			if i != next {
+				return "", "", fmt.Errorf("invalid split_format %q: fields must run from YYYY down to ss without gaps so values sort by time", format)
+			}
+			layout.WriteString(t.layout)
+			if t.granularity != "" {
+				finest = t.granularity
+			}
+			rest = rest[len(t.token):]
+			next++
+			matched = true
+			break
+		}
+		if matched {
+			continue
+		}
+		if strings.ContainsAny(rest[:1], "0123456789YMDHms") {
+			return "", "", fmt.Errorf("invalid split_format %q: unexpected %q (use YYYY, MM, DD, HH, mm, ss and separators)", format, rest[:1])
+		}
+		layout.WriteByte(rest[0])
+		rest = rest[1:]
+	}
+
+	if next == 0 {
+		return "", "", fmt.Errorf("invalid split_format %q: must start with YYYY", format)
+	}
+	return layout.String(), finest, nil
+}
+
+// CheckGranularity rejects string formats too coarse for the table
+// granularity, e.g. YYYYMM on a daily table
+func (s SplitType) CheckGranularity(granularity string) error {
+	if s.Kind != SplitString {
+		return nil
+	}
+
+	granularity = normalizeGranularity(granularity)
+	// Quarters start on the first of a month
+	if granularityRank[s.finest] < granularityRank[granularity] && !(s.finest == GranularityMonth && granularity == GranularityQuarter) {
+		return fmt.Errorf("split_format %q cannot express %s boundaries", s.Format, granularity)
+	}
+	return nil
+}
+
+// String names the split type for logs and errors
+func (s SplitType) String() string {
+	switch s.Kind {
+	case "":
+		return SplitDatetime
+	case SplitString:
+		return fmt.Sprintf("%s (%s)", SplitString, s.Format)
+	default:
+		return s.Kind
+	}
+}
+
+// location returns the business time zone
+func (s SplitType) location() *time.Location {
+	if s.loc == nil {
+		return time.UTC
+	}
+	return s.loc
+}
+
+// Bound encodes a period boundary (a wall clock) as a value of
+// split_column. Epoch bounds are the instant the wall clock occurs in the
+// business time zone; datetime and string bounds stay wall clocks, read by
+// the database in the session time zone. Boundaries fall on midnight, so
+// datetime bounds render as plain dates.
+func (s SplitType) Bound(t time.Time) interface{} {
+	switch s.Kind {
+	case SplitEpochSecond:
+		return inZone(t, s.location()).Unix()
+	case SplitEpochMilli:
+		return inZone(t, s.location()).UnixMilli()
+	case SplitString:
+		return t.Format(s.layout)
+	}
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// Time decodes a scanned split_column value (ok is false for NULL). Epoch
+// values are returned in the business time zone, text is parsed as a wall
+// clock in it.
+func (s SplitType) Time(value interface{}) (time.Time, bool, error) {
+	if b, isBytes := value.([]byte); isBytes {
+		value = string(b)
+	}
+	if value == nil {
+		return time.Time{}, false, nil
+	}
+
+	switch s.Kind {
+	case SplitEpochSecond, SplitEpochMilli:
+		var n int64
+		switch v := value.(type) {
+		case int64:
+			n = v
+		case float64:
+			n = int64(v)
+		case string:
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return time.Time{}, false, fmt.Errorf("cannot parse %q as %s", v, s.Kind)
+			}
+			n = parsed
+		default:
+			return time.Time{}, false, fmt.Errorf("unsupported value %v (%T) for split_type %s", value, value, s.Kind)
+		}
+		if s.Kind == SplitEpochMilli {
+			return time.UnixMilli(n).In(s.location()), true, nil
+		}
+		return time.Unix(n, 0).In(s.location()), true, nil
+	case SplitString:
+		v, isString := value.(string)
+		if !isString {
+			return time.Time{}, false, fmt.Errorf("unsupported value %v (%T) for split_type %s", value, value, s)
+		}
+		t, err := time.ParseInLocation(s.layout, v, s.location())
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("cannot parse %q with split_format %s", v, s.Format)
+		}
+		return t, true, nil
+	default:
+		return scannedTime(value, s.location())
+	}
+}
+
+// splitColumnKinds lists the column kinds each split type can be stored in
+var splitColumnKinds = map[string][]TypeKind{
+	SplitDatetime:    {KindDate, KindDateTime, KindTimestampTZ},
+	SplitEpochSecond: {KindInt},
+	SplitEpochMilli:  {KindInt},
+	SplitString:      {KindChar, KindVarchar, KindText},
+}
+
+// CheckSplitColumn checks the split_column of a table (for split_via, the
+// column of the parent) against its split_type using the column type
+// reported by the source
+func CheckSplitColumn(db *gorm.DB, table *types.Table) error {
+	split, err := ParseSplitType(table)
+	if err != nil {
+		return err
+	}
+
+	col, err := splitColumnInfo(db, splitSource(table))
+	if err != nil {
+		return err
+	}
+
+	logical := ParseColumnType(col.Type)
+	kind := split.Kind
+	if kind == "" {
+		kind = SplitDatetime
+	}
+	for _, allowed := range splitColumnKinds[kind] {
+		if logical.Kind != allowed {
+			continue
+		}
+		if split.Kind == SplitString && logical.Length > 0 && logical.Length < len(split.layout) {
+			return fmt.Errorf("split_column %s is %s, too short for split_format %s", col.Field, col.Type, split.Format)
+		}
+		return nil
+	}
+
+	hint := ""
+	if logical.Kind == KindInt && kind == SplitDatetime {
+		hint = " (set split_type: epoch_s or epoch_ms for Unix timestamps)"
+	}
+	return fmt.Errorf("split_column %s is %s, which does not match split_type %s%s", col.Field, col.Type, split, hint)
+}
+
+// splitColumnInfo returns the column information of a table's split_column
+func splitColumnInfo(db *gorm.DB, table *types.Table) (ColumnInfo, error) {
+	columns, err := GetTableColumns(db, table.Name)
+	if err != nil {
+		return ColumnInfo{}, fmt.Errorf("failed to get columns for table %s: %w", table.Name, err)
+	}
+	for _, col := range columns {
+		if strings.EqualFold(col.Field, table.SplitColumn) {
+			return col, nil
+		}
+	}
+	return ColumnInfo{}, fmt.Errorf("split column %s not found in table %s", table.SplitColumn, table.Name)
+}
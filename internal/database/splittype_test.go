@@ -0,0 +1,76 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitLayout(t *testing.T) {
+	tests := []struct {
+		format     string
+		wantLayout string
+		wantFinest string
+	}{
+		{"YYYY", "2006", GranularityYear},
+		{"YYYYMM", "200601", GranularityMonth},
+		{"YYYY-MM", "2006-01", GranularityMonth},
+		{"YYYYMMDD", "20060102", GranularityDay},
+		{"YYYY/MM/DD", "2006/01/02", GranularityDay},
+		{"YYYY-MM-DD HH:mm:ss", "2006-01-02 15:04:05", GranularityDay},
+		{"YYYYMMDDHHmmss", "20060102150405", GranularityDay},
+	}
+
+	for _, tt := range tests {
+		layout, finest, err := splitLayout(tt.format)
+		if err != nil {
+			t.Errorf("splitLayout(%q): %v", tt.format, err)
+			continue
+		}
+		if layout != tt.wantLayout || finest != tt.wantFinest {
+			t.Errorf("splitLayout(%q) = %q, %s, want %q, %s", tt.format, layout, finest, tt.wantLayout, tt.wantFinest)
+		}
+	}
+}
+
+func TestSplitLayoutInvalid(t *testing.T) {
+	tests := []struct {
+		format  string
+		wantErr string
+	}{
+		{"", "split_format is required"},
+		{"MMDD", "fields must run from YYYY"},
+		{"DDMMYYYY", "fields must run from YYYY"},
+		{"YYYYDD", "fields must run from YYYY"},
+		{"YYYY-MM-DD mm", "fields must run from YYYY"},
+		{"YY", "unexpected"},
+		{"YYYYMMDD2", "unexpected"},
+		{"-", "must start with YYYY"},
+	}
+
+	for _, tt := range tests {
+		_, _, err := splitLayout(tt.format)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("splitLayout(%q) error = %v, want %q", tt.format, err, tt.wantErr)
+		}
+	}
+}
+
+// Formatted bounds must sort like the times they encode
+func TestSplitLayoutSortsByTime(t *testing.T) {
+	layout, _, err := splitLayout("YYYY-MM-DD HH:mm:ss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := []time.Time{
+		time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC),
+		time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC),
+	}
+	for i := 1; i < len(times); i++ {
+		if prev, next := times[i-1].Format(layout), times[i].Format(layout); prev >= next {
+			t.Errorf("%q does not sort before %q", prev, next)
+		}
+	}
+}
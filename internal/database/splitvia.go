@@ -0,0 +1,55 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/gorm"
+)
+
+// Tables with split_via have no date of their own: LoadConfig links them to
+// their parent (table.Parent), and their rows are selected with
+// "key IN (SELECT parent_key FROM parent WHERE <period of parent column>)".
+
+// ResolveSplitVia checks the key column of a split_via table and fills in
+// the default parent_key (the parent's primary key). Tables without
+// split_via are left alone.
+func ResolveSplitVia(db *gorm.DB, table *types.Table) error {
+	if table.SplitVia == nil || table.Parent == nil {
+		return nil
+	}
+	link := table.Parent
+
+	columns, err := GetTableColumns(db, table.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get columns for table %s: %w", table.Name, err)
+	}
+	found := false
+	for _, col := range columns {
+		if strings.EqualFold(col.Field, link.Key) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("split_via key %s not found in table %s", link.Key, table.Name)
+	}
+
+	if link.ParentKey == "" {
+		if link.ParentKey, err = defaultParentKey(db, link.Parent.Name, "split_via of table "+table.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitSource returns the table holding the date column of a table: the
+// table itself, or for split_via the parent it is linked to
+func splitSource(table *types.Table) *types.Table {
+	for table.SplitColumn == "" && table.Parent != nil {
+		table = table.Parent.Parent
+	}
+	return table
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"data-splitter/pkg/types"
+)
+
+// Periods are calendar wall-clock ranges; database.time_zone decides which
+// instants they cover. The same zone is set as the session time zone, so
+// the date strings bound for DATETIME/TIMESTAMP columns are read in it, and
+// epoch bounds are computed from it.
+
+// LoadTimeZone resolves a time_zone setting ("" means UTC)
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q (expected an IANA name such as Asia/Jakarta): %w", name, err)
+	}
+	return loc, nil
+}
+
+// mysqlSessionTimeZone returns the value for MySQL's time_zone variable.
+// Zones without daylight saving are sent as a fixed offset ("+07:00"),
+// which works even when the server has no time zone tables loaded.
+func mysqlSessionTimeZone(loc *time.Location) string {
+	year := time.Now().Year()
+	_, january := time.Date(year, 1, 1, 0, 0, 0, 0, loc).Zone()
+	_, july := time.Date(year, 7, 1, 0, 0, 0, 0, loc).Zone()
+	if january != july {
+		return loc.String()
+	}
+
+	sign := '+'
+	if january < 0 {
+		sign, january = '-', -january
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, january/3600, january%3600/60)
+}
+
+// inZone returns the instant at which wall clock t occurs in loc
+func inZone(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// PeriodBounds renders the boundaries of a period in the table's time zone
+// for PLAN lines, e.g.
+// "start=2024-01-01T00:00:00+07:00 end=2025-01-01T00:00:00+07:00 time_zone=Asia/Jakarta"
+func PeriodBounds(table *types.Table, period Period) (string, error) {
+	loc, err := LoadTimeZone(table.TimeZone)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("start=%s end=%s time_zone=%s",
+		inZone(period.Start, loc).Format(time.RFC3339), inZone(period.End, loc).Format(time.RFC3339), loc), nil
+}
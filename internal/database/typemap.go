@@ -0,0 +1,389 @@
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// When the archive uses a different engine than the source, the source DDL
+// cannot be replayed. Instead every source column type is parsed into a
+// LogicalType and the archive dialect renders it with its own type names
+// (Dialect.ColumnType). The resulting TableMapping produces the archive DDL,
+// converts scanned values before insert and is written out as a report.
+
+// TypeKind classifies a column type independently of the engine
+type TypeKind int
+
+const (
+	KindUnknown TypeKind = iota
+	KindBool
+	KindInt
+	KindDecimal
+	KindFloat
+	KindDate
+	KindDateTime
+	KindTimestampTZ
+	KindTime
+	KindYear
+	KindChar
+	KindVarchar
+	KindText
+	KindBinary
+	KindJSON
+	KindEnum
+	KindSet
+	KindUUID
+	KindBit
+)
+
+// LogicalType is an engine-neutral description of a column type
+type LogicalType struct {
+	Kind      TypeKind
+	Bits      int  // integer / float / bit width
+	Unsigned  bool // MySQL unsigned integers
+	Length    int  // char / varchar length
+	Precision int  // decimal precision
+	Scale     int  // decimal scale
+	Values    []string
+	Raw       string // type as reported by the source
+}
+
+// ColumnType is the archive-side rendering of a LogicalType
+type ColumnType struct {
+	Name  string // type used in CREATE TABLE
+	Check string // optional CHECK constraint expression
+	Note  string // explains widening or lossy conversions
+	Lossy bool   // values may not round-trip exactly
+
+	convert valueConverter
+}
+
+// valueConverter adapts a value scanned from the source for the archive driver
+type valueConverter func(interface{}) interface{}
+
+// ColumnMapping pairs a source column with its archive type
+type ColumnMapping struct {
+	Column     string
+	SourceType string
+	Nullable   bool
+	Target     ColumnType
+}
+
+// TableMapping describes how a table is recreated on another engine
+type TableMapping struct {
+	Table       string
+	Source      string
+	Target      string
+	Columns     []ColumnMapping
+	PrimaryKeys []string
+}
+
+// ParseColumnType parses a MySQL or PostgreSQL column type as reported by
+// GetTableColumns into a LogicalType
+func ParseColumnType(raw string) LogicalType {
+	t := strings.ToLower(strings.TrimSpace(raw))
+	lt := LogicalType{Raw: raw, Unsigned: strings.Contains(t, " unsigned")}
+
+	base, args := t, ""
+	if open := strings.Index(t, "("); open >= 0 {
+		base = strings.TrimSpace(t[:open])
+		if end := strings.LastIndex(t, ")"); end > open {
+			args = strings.TrimSpace(raw)[open+1 : end]
+		}
+	} else if idx := strings.Index(t, " "); idx >= 0 {
+		base = t[:idx]
+	}
+	withTZ := strings.Contains(t, "with time zone")
+
+	switch base {
+	case "tinyint":
+		if args == "1" {
+			lt.Kind = KindBool
+		} else {
+			lt.Kind, lt.Bits = KindInt, 8
+		}
+	case "bool", "boolean":
+		lt.Kind = KindBool
+	case "smallint", "int2", "smallserial":
+		lt.Kind, lt.Bits = KindInt, 16
+	case "mediumint":
+		lt.Kind, lt.Bits = KindInt, 24
+	case "int", "integer", "int4", "serial":
+		lt.Kind, lt.Bits = KindInt, 32
+	case "bigint", "int8", "bigserial":
+		lt.Kind, lt.Bits = KindInt, 64
+	case "decimal", "numeric", "dec", "fixed":
+		lt.Kind = KindDecimal
+		lt.Precision, lt.Scale = parseTypeInts(args)
+	case "float", "real", "float4":
+		lt.Kind, lt.Bits = KindFloat, 32
+	case "double", "float8":
+		lt.Kind, lt.Bits = KindFloat, 64
+	case "date":
+		lt.Kind = KindDate
+	case "datetime":
+		lt.Kind = KindDateTime
+	case "timestamp":
+		lt.Kind = KindDateTime
+		if withTZ {
+			lt.Kind = KindTimestampTZ
+		}
+	case "timestamptz":
+		lt.Kind = KindTimestampTZ
+	case "time", "timetz":
+		lt.Kind = KindTime
+	case "year":
+		lt.Kind = KindYear
+	case "char", "character", "nchar", "bpchar":
+		lt.Kind = KindChar
+		lt.Length, _ = parseTypeInts(args)
+	case "varchar", "nvarchar", "character varying":
+		lt.Kind = KindVarchar
+		lt.Length, _ = parseTypeInts(args)
+	case "tinytext", "text", "mediumtext", "longtext", "citext":
+		lt.Kind = KindText
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "bytea":
+		lt.Kind = KindBinary
+	case "json", "jsonb":
+		lt.Kind = KindJSON
+	case "enum":
+		lt.Kind, lt.Values = KindEnum, parseEnumValues(args)
+	case "set":
+		lt.Kind, lt.Values = KindSet, parseEnumValues(args)
+	case "uuid":
+		lt.Kind = KindUUID
+	case "bit":
+		lt.Kind = KindBit
+		lt.Bits, _ = parseTypeInts(args)
+		if lt.Bits == 0 {
+			lt.Bits = 1
+		}
+	}
+
+	return lt
+}
+
+// parseTypeInts parses "10,2" style type arguments
+func parseTypeInts(args string) (int, int) {
+	parts := strings.Split(args, ",")
+	first, _ := strconv.Atoi(strings.TrimSpace(parts[0]))
+	second := 0
+	if len(parts) > 1 {
+		second, _ = strconv.Atoi(strings.TrimSpace(parts[1]))
+	}
+	return first, second
+}
+
+// parseEnumValues parses the quoted member list of enum('a','b”c')
+func parseEnumValues(args string) []string {
+	var values []string
+	var current strings.Builder
+	inQuote := false
+
+	for i := 0; i < len(args); i++ {
+		c := args[i]
+		switch {
+		case c == '\'' && inQuote && i+1 < len(args) && args[i+1] == '\'':
+			current.WriteByte('\'')
+			i++
+		case c == '\'':
+			if inQuote {
+				values = append(values, current.String())
+				current.Reset()
+			}
+			inQuote = !inQuote
+		case inQuote:
+			current.WriteByte(c)
+		}
+	}
+
+	return values
+}
+
+// sqlStringList renders values as a comma-separated list of SQL string literals
+func sqlStringList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// BuildTableMapping maps every column of a source table to the target dialect
+func BuildTableMapping(sourceDB *gorm.DB, target Dialect, tableName string) (*TableMapping, error) {
+	columns, err := GetTableColumns(sourceDB, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns for table %s: %w", tableName, err)
+	}
+
+	primaryKeys, err := GetPrimaryKeyColumns(sourceDB, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get primary keys for table %s: %w", tableName, err)
+	}
+
+	mapping := &TableMapping{
+		Table:       tableName,
+		Source:      DialectOf(sourceDB).Name(),
+		Target:      target.Name(),
+		PrimaryKeys: primaryKeys,
+	}
+
+	for _, col := range columns {
+		mapping.Columns = append(mapping.Columns, ColumnMapping{
+			Column:     col.Field,
+			SourceType: col.Type,
+			Nullable:   col.Null != "NO",
+			Target:     target.ColumnType(col.Field, ParseColumnType(col.Type)),
+		})
+	}
+
+	return mapping, nil
+}
+
+// CreateTableSQL renders the archive CREATE TABLE statement
+func (m *TableMapping) CreateTableSQL(target Dialect) string {
+	var defs []string
+	for _, col := range m.Columns {
+		def := fmt.Sprintf("%s %s", target.QuoteIdent(col.Column), col.Target.Name)
+		if !col.Nullable {
+			def += " NOT NULL"
+		}
+		if col.Target.Check != "" {
+			def += fmt.Sprintf(" CHECK (%s)", col.Target.Check)
+		}
+		defs = append(defs, def)
+	}
+
+	if len(m.PrimaryKeys) > 0 {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", quoteIdentList(target, m.PrimaryKeys)))
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (\n  %s\n)", target.QuoteIdent(m.Table), strings.Join(defs, ",\n  "))
+}
+
+// ConvertRow converts the values of one scanned row in place
+func (m *TableMapping) ConvertRow(values []interface{}) {
+	for i := range values {
+		if i < len(m.Columns) && m.Columns[i].Target.convert != nil && values[i] != nil {
+			values[i] = m.Columns[i].Target.convert(values[i])
+		}
+	}
+}
+
+// LossyColumns returns the columns whose values may not round-trip exactly
+func (m *TableMapping) LossyColumns() []ColumnMapping {
+	var lossy []ColumnMapping
+	for _, col := range m.Columns {
+		if col.Target.Lossy {
+			lossy = append(lossy, col)
+		}
+	}
+	return lossy
+}
+
+// WriteReport writes a human-readable mapping report into dir and returns
+// the path of the report file
+func (m *TableMapping) WriteReport(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create report directory %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("type-mapping-%s-%s-to-%s.txt", m.Table, m.Source, m.Target))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create mapping report %s: %w", path, err)
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "Type mapping report: table %s (%s -> %s)\n", m.Table, m.Source, m.Target)
+	fmt.Fprintf(f, "Generated: %s\n\n", time.Now().Format(time.RFC3339))
+
+	w := tabwriter.NewWriter(f, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "COLUMN\tSOURCE TYPE\tTARGET TYPE\tLOSSY\tNOTE")
+	for _, col := range m.Columns {
+		target := col.Target.Name
+		if col.Target.Check != "" {
+			target += " CHECK"
+		}
+		lossy := ""
+		if col.Target.Lossy {
+			lossy = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", col.Column, col.SourceType, target, lossy, col.Target.Note)
+	}
+	if err := w.Flush(); err != nil {
+		return "", fmt.Errorf("failed to write mapping report %s: %w", path, err)
+	}
+
+	fmt.Fprintf(f, "\nLossy conversions: %d\n", len(m.LossyColumns()))
+	return path, nil
+}
+
+// Value converters used by the dialects' ColumnType implementations
+
+// toText turns raw bytes (how the MySQL driver returns strings, decimals and
+// JSON) into a string so drivers encode them as text rather than binary
+func toText(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// toBool converts tinyint(1) / bit(1) values into a bool
+func toBool(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int64:
+		return x != 0
+	case uint64:
+		return x != 0
+	case []byte:
+		if len(x) == 1 && (x[0] == 0 || x[0] == 1) {
+			return x[0] == 1
+		}
+		s := string(x)
+		return s != "0" && s != "" && s != "f" && s != "false"
+	case string:
+		return x != "0" && x != "" && x != "f" && x != "false"
+	}
+	return v
+}
+
+// toDecimalString renders unsigned 64-bit values (which may exceed the
+// signed range drivers support) and raw bytes as decimal strings
+func toDecimalString(v interface{}) interface{} {
+	switch x := v.(type) {
+	case uint64:
+		return strconv.FormatUint(x, 10)
+	case []byte:
+		return string(x)
+	}
+	return v
+}
+
+// bitsToInt converts a MySQL BIT(n) value (big-endian bytes) to an integer
+func bitsToInt(v interface{}) interface{} {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	var buf [8]byte
+	if len(b) > 8 {
+		b = b[len(b)-8:]
+	}
+	copy(buf[8-len(b):], b)
+	return int64(binary.BigEndian.Uint64(buf[:]))
+}
+
+// textColumn returns a ColumnType whose values are passed as strings
+func textColumn(name string) ColumnType {
+	return ColumnType{Name: name, convert: toText}
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"data-splitter/pkg/types"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Uploads copy a sealed export to S3-compatible object storage. Every part
+// is read back after the upload and its SHA-256 compared with the manifest;
+// only then is the upload recorded in the manifest, which DeleteMigratedData
+// requires before purging the source (see requireSealedExport).
+
+const (
+	defaultUploadPartSizeMB = 64
+	defaultUploadRetries    = 3
+)
+
+// ExportUpload records where a verified export was uploaded
+type ExportUpload struct {
+	Endpoint   string    `json:"endpoint"`
+	Bucket     string    `json:"bucket"`
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+// checkUploaded fails unless the manifest records a verified upload of
+// every file to the configured bucket
+func (m *ExportManifest) checkUploaded(upload *types.Upload) error {
+	if m.Upload == nil || m.Upload.Bucket != upload.Bucket || m.Upload.Endpoint != upload.Endpoint {
+		return fmt.Errorf("export for table %s period %s has not been uploaded to %s/%s", m.Table, m.Period, upload.Endpoint, upload.Bucket)
+	}
+	for _, file := range m.Files {
+		if file.Key == "" {
+			return fmt.Errorf("export file %s has not been uploaded", file.Name)
+		}
+	}
+	return nil
+}
+
+// BuildObjectKey builds the object key of an export file from key_pattern
+// (default: archive_pattern + "/{file}")
+func BuildObjectKey(table *types.Table, period Period, fileName string) string {
+	pattern := table.Export.Upload.KeyPattern
+	if pattern == "" {
+		pattern = table.ArchivePattern + "/{file}"
+	}
+
+	key := BuildArchiveDBName(pattern, table.Name, period)
+	key = strings.Replace(key, "{file}", fileName, -1)
+	key = path.Clean(filepath.ToSlash(key))
+	return strings.TrimLeft(strings.TrimPrefix(key, "./"), "/")
+}
+
+// newUploadClient connects to the configured object storage endpoint
+func newUploadClient(upload *types.Upload) (*minio.Client, error) {
+	lookup := minio.BucketLookupAuto
+	if upload.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(upload.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(upload.AccessKey, upload.SecretKey, ""),
+		Secure:       !upload.DisableTLS,
+		Region:       upload.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object storage client for %s: %w", upload.Endpoint, err)
+	}
+
+	return client, nil
+}
+
+// UploadExport uploads every file of a sealed table/period export, verifies
+// the uploaded checksums against the manifest and finally uploads the
+// manifest itself, so its presence in the bucket marks a complete export.
+func UploadExport(table *types.Table, period Period) error {
+	upload := table.Export.Upload
+
+	manifest, err := LoadExportManifest(table, period)
+	if err != nil {
+		return err
+	}
+	if err := manifest.checkIdentity(table, period); err != nil {
+		return err
+	}
+	if !manifest.Sealed {
+		return fmt.Errorf("export for table %s period %s is not sealed", table.Name, period)
+	}
+
+	client, err := newUploadClient(upload)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, upload.Bucket)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket %s: %w", upload.Bucket, err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist on %s", upload.Bucket, upload.Endpoint)
+	}
+
+	dir := ExportDir(table, period)
+	for i := range manifest.Files {
+		file := &manifest.Files[i]
+		key := BuildObjectKey(table, period, file.Name)
+
+		err := withUploadRetries(upload, key, func() error {
+			return uploadFile(ctx, client, upload, filepath.Join(dir, file.Name), key, file.SHA256)
+		})
+		if err != nil {
+			return err
+		}
+		file.Key = key
+	}
+
+	manifest.Upload = &ExportUpload{
+		Endpoint:   upload.Endpoint,
+		Bucket:     upload.Bucket,
+		VerifiedAt: time.Now(),
+	}
+	manifestPath := ExportManifestPath(table, period)
+	if err := writeExportManifest(manifestPath, manifest); err != nil {
+		return err
+	}
+
+	_, manifestName := filepath.Split(manifestPath)
+	manifestKey := BuildObjectKey(table, period, manifestName)
+	err = withUploadRetries(upload, manifestKey, func() error {
+		_, err := client.FPutObject(ctx, upload.Bucket, manifestKey, manifestPath, minio.PutObjectOptions{ContentType: "application/json"})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Uploaded export for table %s, period %s to %s/%s: %d file(s) verified", table.Name, period, upload.Endpoint, upload.Bucket, len(manifest.Files))
+	return nil
+}
+
+// withUploadRetries runs fn up to max_retries times with a growing delay
+func withUploadRetries(upload *types.Upload, key string, fn func() error) error {
+	attempts := upload.MaxRetries
+	if attempts <= 0 {
+		attempts = defaultUploadRetries
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt < attempts {
+			delay := time.Duration(attempt*attempt) * time.Second
+			log.Printf("Upload of %s failed (attempt %d/%d): %v - retrying in %s", key, attempt, attempts, err, delay)
+			time.Sleep(delay)
+		}
+	}
+
+	return fmt.Errorf("failed to upload %s after %d attempts: %w", key, attempts, err)
+}
+
+// uploadFile uploads one file (multipart above part_size_mb) and verifies
+// the stored object by reading it back and comparing its SHA-256
+func uploadFile(ctx context.Context, client *minio.Client, upload *types.Upload, localPath, key, expectedSHA256 string) error {
+	partSizeMB := upload.PartSizeMB
+	if partSizeMB <= 0 {
+		partSizeMB = defaultUploadPartSizeMB
+	}
+
+	info, err := client.FPutObject(ctx, upload.Bucket, key, localPath, minio.PutObjectOptions{
+		ContentType:  "application/octet-stream",
+		PartSize:     uint64(partSizeMB) * 1024 * 1024,
+		UserMetadata: map[string]string{"sha256": expectedSHA256},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", localPath, err)
+	}
+	log.Printf("Uploaded %s to %s/%s (%d bytes)", localPath, upload.Bucket, key, info.Size)
+
+	object, err := client.GetObject(ctx, upload.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to read back %s: %w", key, err)
+	}
+	defer object.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, object); err != nil {
+		return fmt.Errorf("failed to read back %s: %w", key, err)
+	}
+
+	if sum := hex.EncodeToString(hasher.Sum(nil)); sum != expectedSHA256 {
+		return fmt.Errorf("uploaded object %s has sha256 %s, manifest expects %s", key, sum, expectedSHA256)
+	}
+
+	return nil
+}
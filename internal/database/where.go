@@ -0,0 +1,426 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/gorm"
+)
+
+// RowCondition is a parsed table.where clause. Only a small grammar is
+// accepted so the clause can be checked when the config is loaded and
+// rendered with quoted identifiers and bound values instead of being pasted
+// into the SQL:
+//
+//	expr      = term { OR term }
+//	term      = factor { AND factor }
+//	factor    = NOT factor | "(" expr ")" | predicate
+//	predicate = column ( op literal
+//	                   | [NOT] IN "(" literal { "," literal } ")"
+//	                   | IS [NOT] NULL
+//	                   | [NOT] LIKE string
+//	                   | [NOT] BETWEEN literal AND literal )
+//	op        = "=" | "!=" | "<>" | "<" | "<=" | ">" | ">="
+//	literal   = 'string' | number | TRUE | FALSE
+type RowCondition struct {
+	Source string
+	root   condNode
+}
+
+// condNode is a node of a parsed condition
+type condNode interface {
+	render(d Dialect, args *[]interface{}) string
+	columns() []string
+}
+
+type logicalNode struct {
+	op       string // AND or OR
+	children []condNode
+}
+
+func (n *logicalNode) render(d Dialect, args *[]interface{}) string {
+	parts := make([]string, len(n.children))
+	for i, child := range n.children {
+		parts[i] = child.render(d, args)
+	}
+	return "(" + strings.Join(parts, " "+n.op+" ") + ")"
+}
+
+func (n *logicalNode) columns() []string {
+	var cols []string
+	for _, child := range n.children {
+		cols = append(cols, child.columns()...)
+	}
+	return cols
+}
+
+type notNode struct{ child condNode }
+
+func (n *notNode) render(d Dialect, args *[]interface{}) string {
+	return "NOT " + n.child.render(d, args)
+}
+
+func (n *notNode) columns() []string { return n.child.columns() }
+
+// predicateNode compares a column: op is "=", "IN", "IS NULL", "LIKE",
+// "BETWEEN", ... (negated forms set not)
+type predicateNode struct {
+	column string
+	op     string
+	not    bool
+	values []interface{}
+}
+
+func (n *predicateNode) render(d Dialect, args *[]interface{}) string {
+	column := d.QuoteIdent(n.column)
+	not := ""
+	if n.not {
+		not = "NOT "
+	}
+
+	*args = append(*args, n.values...)
+	switch n.op {
+	case "IS NULL":
+		return fmt.Sprintf("%s IS %sNULL", column, not)
+	case "IN":
+		return fmt.Sprintf("%s %sIN (%s)", column, not, strings.TrimSuffix(strings.Repeat("?, ", len(n.values)), ", "))
+	case "BETWEEN":
+		return fmt.Sprintf("%s %sBETWEEN ? AND ?", column, not)
+	case "LIKE":
+		return fmt.Sprintf("%s %sLIKE ?", column, not)
+	default:
+		return fmt.Sprintf("%s %s ?", column, n.op)
+	}
+}
+
+func (n *predicateNode) columns() []string { return []string{n.column} }
+
+// ParseRowCondition parses a table.where clause
+func ParseRowCondition(source string) (*RowCondition, error) {
+	tokens, err := tokenizeCondition(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty condition")
+	}
+
+	p := &conditionParser{tokens: tokens}
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return &RowCondition{Source: source, root: root}, nil
+}
+
+// SQL renders the condition for a dialect with ? placeholders
+func (c *RowCondition) SQL(d Dialect) (string, []interface{}) {
+	var args []interface{}
+	return c.root.render(d, &args), args
+}
+
+// Columns lists the columns the condition refers to
+func (c *RowCondition) Columns() []string { return c.root.columns() }
+
+// tableCondition returns the parsed where clause of a table (nil if none)
+func tableCondition(table *types.Table) (*RowCondition, error) {
+	if strings.TrimSpace(table.Where) == "" {
+		return nil, nil
+	}
+	cond, err := ParseRowCondition(table.Where)
+	if err != nil {
+		return nil, fmt.Errorf("invalid where for table %s: %w", table.Name, err)
+	}
+	return cond, nil
+}
+
+// CheckRowCondition checks that the columns of a table's where clause exist
+// in db
+func CheckRowCondition(db *gorm.DB, table *types.Table) error {
+	cond, err := tableCondition(table)
+	if err != nil || cond == nil {
+		return err
+	}
+
+	columns, err := GetTableColumns(db, table.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get columns for table %s: %w", table.Name, err)
+	}
+	for _, name := range cond.Columns() {
+		found := false
+		for _, col := range columns {
+			if strings.EqualFold(col.Field, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("where of table %s refers to unknown column %s", table.Name, name)
+		}
+	}
+	return nil
+}
+
+// conditionToken is a lexical token of a where clause
+type conditionToken struct {
+	kind string // ident, keyword, string, number, op, punct
+	text string // keywords upper-cased, strings unquoted
+}
+
+var conditionKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "IN": true, "IS": true, "NULL": true,
+	"LIKE": true, "BETWEEN": true, "TRUE": true, "FALSE": true,
+}
+
+func tokenizeCondition(s string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s); j++ {
+				if s[j] == '\'' {
+					if j+1 < len(s) && s[j+1] == '\'' {
+						b.WriteByte('\'')
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string starting at %q", s[i:])
+			}
+			tokens = append(tokens, conditionToken{kind: "string", text: b.String()})
+			i = j + 1
+		case c == '`' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted identifier starting at %q", s[i:])
+			}
+			tokens = append(tokens, conditionToken{kind: "ident", text: s[i+1 : i+1+end]})
+			i += end + 2
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, conditionToken{kind: "punct", text: string(c)})
+			i++
+		case strings.IndexByte("=<>!", c) >= 0:
+			op := string(c)
+			if i+1 < len(s) && (s[i:i+2] == "<=" || s[i:i+2] == ">=" || s[i:i+2] == "<>" || s[i:i+2] == "!=") {
+				op = s[i : i+2]
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected %q", op)
+			}
+			tokens = append(tokens, conditionToken{kind: "op", text: op})
+			i += len(op)
+		case c == '-' || c == '.' || unicode.IsDigit(rune(c)):
+			j := i + 1
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, conditionToken{kind: "number", text: s[i:j]})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			word := s[i:j]
+			if conditionKeywords[strings.ToUpper(word)] {
+				tokens = append(tokens, conditionToken{kind: "keyword", text: strings.ToUpper(word)})
+			} else {
+				tokens = append(tokens, conditionToken{kind: "ident", text: word})
+			}
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q (only comparisons of columns with literals are allowed)", string(c))
+		}
+	}
+	return tokens, nil
+}
+
+// conditionParser is a recursive descent parser over the tokens of a where
+// clause (see RowCondition for the grammar)
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+}
+
+func (p *conditionParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *conditionParser) peek() conditionToken {
+	if p.done() {
+		return conditionToken{kind: "end", text: "end of condition"}
+	}
+	return p.tokens[p.pos]
+}
+
+// accept consumes the next token if it is the given keyword or punctuation
+func (p *conditionParser) accept(text string) bool {
+	if t := p.peek(); (t.kind == "keyword" || t.kind == "punct") && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *conditionParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected %s, found %q", text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *conditionParser) expr() (condNode, error) {
+	return p.logical("OR", p.term)
+}
+
+func (p *conditionParser) term() (condNode, error) {
+	return p.logical("AND", p.factor)
+}
+
+// logical parses operands joined by op (AND / OR)
+func (p *conditionParser) logical(op string, operand func() (condNode, error)) (condNode, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	children := []condNode{first}
+	for p.accept(op) {
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &logicalNode{op: op, children: children}, nil
+}
+
+func (p *conditionParser) factor() (condNode, error) {
+	if p.accept("NOT") {
+		child, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	}
+	if p.accept("(") {
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &logicalNode{op: "AND", children: []condNode{inner}}, nil
+	}
+	return p.predicate()
+}
+
+func (p *conditionParser) predicate() (condNode, error) {
+	t := p.peek()
+	if t.kind != "ident" {
+		return nil, fmt.Errorf("expected a column name, found %q", t.text)
+	}
+	p.pos++
+	n := &predicateNode{column: t.text}
+
+	if op := p.peek(); op.kind == "op" {
+		p.pos++
+		if op.text == "<>" {
+			op.text = "!="
+		}
+		value, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		n.op, n.values = op.text, []interface{}{value}
+		return n, nil
+	}
+
+	if p.accept("IS") {
+		n.op, n.not = "IS NULL", p.accept("NOT")
+		return n, p.expect("NULL")
+	}
+
+	n.not = p.accept("NOT")
+	switch {
+	case p.accept("IN"):
+		n.op = "IN"
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for {
+			value, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, value)
+			if !p.accept(",") {
+				break
+			}
+		}
+		return n, p.expect(")")
+	case p.accept("LIKE"):
+		n.op = "LIKE"
+		if t := p.peek(); t.kind != "string" {
+			return nil, fmt.Errorf("LIKE needs a string pattern, found %q", t.text)
+		}
+		value, _ := p.literal()
+		n.values = []interface{}{value}
+		return n, nil
+	case p.accept("BETWEEN"):
+		n.op = "BETWEEN"
+		low, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		n.values = []interface{}{low, high}
+		return n, nil
+	}
+	return nil, fmt.Errorf("expected a comparison after %s, found %q", n.column, p.peek().text)
+}
+
+// literal parses a string, number or boolean into its bind value
+func (p *conditionParser) literal() (interface{}, error) {
+	t := p.peek()
+	p.pos++
+	switch {
+	case t.kind == "string":
+		return t.text, nil
+	case t.kind == "number":
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return n, nil
+		}
+		if f, err := strconv.ParseFloat(t.text, 64); err == nil {
+			return f, nil
+		}
+		return nil, fmt.Errorf("invalid number %q", t.text)
+	case t.kind == "keyword" && (t.text == "TRUE" || t.text == "FALSE"):
+		return t.text == "TRUE", nil
+	}
+	p.pos--
+	return nil, fmt.Errorf("expected a literal value, found %q", t.text)
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"data-splitter/pkg/types"
+)
+
+func TestParseRowCondition(t *testing.T) {
+	tests := []struct {
+		source   string
+		wantSQL  string
+		wantArgs []interface{}
+		wantCols []string
+	}{
+		{
+			source:   "status = 'closed'",
+			wantSQL:  "`status` = ?",
+			wantArgs: []interface{}{"closed"},
+			wantCols: []string{"status"},
+		},
+		{
+			source:   "amount >= 10.5 and amount <> -1",
+			wantSQL:  "(`amount` >= ? AND `amount` != ?)",
+			wantArgs: []interface{}{10.5, int64(-1)},
+			wantCols: []string{"amount", "amount"},
+		},
+		{
+			source:   "status IN ('closed', 'cancelled') AND deleted_at IS NULL",
+			wantSQL:  "(`status` IN (?, ?) AND `deleted_at` IS NULL)",
+			wantArgs: []interface{}{"closed", "cancelled"},
+			wantCols: []string{"status", "deleted_at"},
+		},
+		{
+			source:   "a = 1 OR b = 2 AND c = 3",
+			wantSQL:  "(`a` = ? OR (`b` = ? AND `c` = ?))",
+			wantArgs: []interface{}{int64(1), int64(2), int64(3)},
+			wantCols: []string{"a", "b", "c"},
+		},
+		{
+			source:   "(a = 1 OR b = 2) AND NOT c = 3",
+			wantSQL:  "(((`a` = ? OR `b` = ?)) AND NOT `c` = ?)",
+			wantArgs: []interface{}{int64(1), int64(2), int64(3)},
+			wantCols: []string{"a", "b", "c"},
+		},
+		{
+			source:   "note NOT LIKE '%it''s%' AND archived = TRUE",
+			wantSQL:  "(`note` NOT LIKE ? AND `archived` = ?)",
+			wantArgs: []interface{}{"%it's%", true},
+			wantCols: []string{"note", "archived"},
+		},
+		{
+			source:   "`order` NOT BETWEEN 1 AND 9 AND \"x y\" IS NOT NULL",
+			wantSQL:  "(`order` NOT BETWEEN ? AND ? AND `x y` IS NOT NULL)",
+			wantArgs: []interface{}{int64(1), int64(9)},
+			wantCols: []string{"order", "x y"},
+		},
+		{
+			source:   "kind NOT IN (1)",
+			wantSQL:  "`kind` NOT IN (?)",
+			wantArgs: []interface{}{int64(1)},
+			wantCols: []string{"kind"},
+		},
+	}
+
+	for _, tt := range tests {
+		cond, err := ParseRowCondition(tt.source)
+		if err != nil {
+			t.Errorf("ParseRowCondition(%q): %v", tt.source, err)
+			continue
+		}
+		sql, args := cond.SQL(mysqlDialect{})
+		if sql != tt.wantSQL {
+			t.Errorf("ParseRowCondition(%q) sql = %q, want %q", tt.source, sql, tt.wantSQL)
+		}
+		if !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("ParseRowCondition(%q) args = %#v, want %#v", tt.source, args, tt.wantArgs)
+		}
+		if cols := cond.Columns(); !reflect.DeepEqual(cols, tt.wantCols) {
+			t.Errorf("ParseRowCondition(%q) columns = %v, want %v", tt.source, cols, tt.wantCols)
+		}
+	}
+}
+
+func TestParseRowConditionRejects(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr string
+	}{
+		{"", "empty condition"},
+		{"   ", "empty condition"},
+		{"status = 'closed'; DROP TABLE orders", "unexpected \";\""},
+		{"status = 'closed' -- comment", "unexpected \"-\""},
+		{"id IN (SELECT id FROM other)", "expected a literal value"},
+		{"LOWER(status) = 'x'", "expected a comparison after LOWER"},
+		{"a = b", "expected a literal value"},
+		{"status = 'open", "unterminated string"},
+		{"`status = 1", "unterminated quoted identifier"},
+		{"a ! 1", "unexpected \"!\""},
+		{"a LIKE 5", "LIKE needs a string pattern"},
+		{"a BETWEEN 1 OR 2", "expected AND"},
+		{"a IN (1, 2", "expected )"},
+		{"a IS 1", "expected NULL"},
+		{"a = 1 b = 2", "unexpected \"b\""},
+		{"a = 1.2.3", "invalid number"},
+		{"a + 1 = 2", "only comparisons of columns with literals"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseRowCondition(tt.source)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParseRowCondition(%q) error = %v, want %q", tt.source, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRowConditionDialects(t *testing.T) {
+	cond, err := ParseRowCondition("status = 'closed'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql, _ := cond.SQL(postgresDialect{}); sql != `"status" = ?` {
+		t.Errorf("postgres sql = %q", sql)
+	}
+	if sql, _ := cond.SQL(sqliteDialect{}); sql != `"status" = ?` {
+		t.Errorf("sqlite sql = %q", sql)
+	}
+}
+
+func TestTablePeriodCondition(t *testing.T) {
+	table := &types.Table{Name: "orders", SplitColumn: "created_at", Where: "status = 'closed'"}
+	sql, args, err := tablePeriodCondition(mysqlDialect{}, table, YearPeriod(2024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSQL := "`created_at` >= ? AND `created_at` < ? AND `status` = ?"
+	if sql != wantSQL {
+		t.Errorf("sql = %q, want %q", sql, wantSQL)
+	}
+	if want := []interface{}{"2024-01-01", "2025-01-01", "closed"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %#v, want %#v", args, want)
+	}
+}
+
+// A child's rows are selected through the parent rows of the period; the
+// child's own where applies to the child, the parent's to the parent
+func TestTablePeriodConditionChild(t *testing.T) {
+	parent := &types.Table{Name: "orders", SplitColumn: "created_at", Where: "status = 'closed'"}
+	child := &types.Table{Name: "order_items", Where: "qty > 0",
+		Parent: &types.ParentLink{Parent: parent, Key: "order_id", ParentKey: "id"}}
+
+	sql, args, err := tablePeriodCondition(mysqlDialect{}, child, YearPeriod(2024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSQL := "`order_id` IN (SELECT `id` FROM `orders` WHERE `created_at` >= ? AND `created_at` < ? AND `status` = ?) AND `qty` > ?"
+	if sql != wantSQL {
+		t.Errorf("sql = %q, want %q", sql, wantSQL)
+	}
+	if want := []interface{}{"2024-01-01", "2025-01-01", "closed", int64(0)}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %#v, want %#v", args, want)
+	}
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-splitter/pkg/types"
+
+	"gorm.io/gorm"
+)
+
+// DiscoveredYears is archive.years: auto resolved for one table from the
+// range of its split_column values
+type DiscoveredYears struct {
+	Oldest time.Time // MIN(split_column) as a wall clock (zero when the table is empty)
+	Newest time.Time // MAX(split_column) as a wall clock
+	Years  []int     // (fiscal) years to archive after min/max/exclude_current
+}
+
+// DiscoverYears lists the years holding data in a table: the years from MIN
+// to MAX of split_column, bounded by the min/max of years and, with
+// exclude_current, stopping before the year containing now, that have rows
+// selected by the migration's own condition (where and split_via included)
+func DiscoverYears(db *gorm.DB, table *types.Table, years *types.Years, now time.Time) (*DiscoveredYears, error) {
+	discovered := &DiscoveredYears{}
+
+	oldest, ok, err := splitValue(db, table, "MIN")
+	if err != nil || !ok {
+		return discovered, err
+	}
+	newest, _, err := splitValue(db, table, "MAX")
+	if err != nil {
+		return nil, err
+	}
+	discovered.Oldest, discovered.Newest = oldest, newest
+
+	first := periodContaining(GranularityYear, table.FiscalYearStart, oldest).Year()
+	last := periodContaining(GranularityYear, table.FiscalYearStart, newest).Year()
+	if years.Min != 0 && first < years.Min {
+		first = years.Min
+	}
+	if years.Max != 0 && last > years.Max {
+		last = years.Max
+	}
+	if years.ExcludeCurrent {
+		loc, err := LoadTimeZone(table.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		current := periodContaining(GranularityYear, table.FiscalYearStart, wallClock(now.In(loc))).Year()
+		if last >= current {
+			last = current - 1
+		}
+	}
+
+	for year := first; year <= last; year++ {
+		found, err := hasRows(db, table, FiscalYearPeriod(year, table.FiscalYearStart))
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			discovered.Years = append(discovered.Years, year)
+		}
+	}
+	return discovered, nil
+}
+
+// Summary renders the discovery on one line for logs and the PLAN output
+func (d *DiscoveredYears) Summary() string {
+	if d.Oldest.IsZero() {
+		return "years=auto oldest=none newest=none discovered=none"
+	}
+
+	discovered := "none"
+	if n := len(d.Years); n > 0 && d.Years[n-1]-d.Years[0] == n-1 {
+		discovered = fmt.Sprintf("%d..%d (%d)", d.Years[0], d.Years[n-1], n)
+	} else if n > 0 {
+		// Years without rows are skipped: list the ones found
+		labels := make([]string, n)
+		for i, year := range d.Years {
+			labels[i] = strconv.Itoa(year)
+		}
+		discovered = fmt.Sprintf("%s (%d)", strings.Join(labels, ","), n)
+	}
+	return fmt.Sprintf("years=auto oldest=%s newest=%s discovered=%s",
+		d.Oldest.Format("2006-01-02T15:04:05"), d.Newest.Format("2006-01-02T15:04:05"), discovered)
+}
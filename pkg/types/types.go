@@ -1,12 +1,21 @@
 package types
 
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
 // Config represents the main configuration structure
 type Config struct {
-	Version    string     `yaml:"version"`
-	Database   Database   `yaml:"database"`
-	Tables     []Table    `yaml:"tables"`
-	Archive    Archive    `yaml:"archive"`
-	Processing Processing `yaml:"processing"`
+	Version  string   `yaml:"version"`
+	Database Database `yaml:"database"`
+	// ArchiveDatabase optionally points archives at a different server.
+	// Empty fields inherit from Database.
+	ArchiveDatabase *Database  `yaml:"archive_database"`
+	Tables          []Table    `yaml:"tables"`
+	Archive         Archive    `yaml:"archive"`
+	Processing      Processing `yaml:"processing"`
 }
 
 // Database holds database connection configuration
@@ -17,25 +26,228 @@ type Database struct {
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	SourceDB string `yaml:"source_db"`
+	// TLS selects transport security: disable, preferred, skip-verify or
+	// verify-full. Empty keeps the driver default.
+	TLS string `yaml:"tls"`
+	// TimeZone is the business time zone (IANA name, e.g. Asia/Jakarta).
+	// Period boundaries are computed in it and it is set as the session
+	// time zone and driver location. Empty means UTC boundaries and the
+	// server's default session time zone.
+	TimeZone string `yaml:"time_zone"`
 }
 
 // Table represents a table to be processed
 type Table struct {
-	Name           string `yaml:"name"`
-	Enabled        bool   `yaml:"enabled"`
-	SplitColumn    string `yaml:"split_column"`
-	ArchivePattern string `yaml:"archive_pattern"`
+	Name        string `yaml:"name"`
+	Enabled     bool   `yaml:"enabled"`
+	SplitColumn string `yaml:"split_column"`
+	// SplitType tells how split_column stores time: datetime (default),
+	// epoch_s, epoch_ms or string (with SplitFormat, e.g. YYYYMMDD)
+	SplitType   string `yaml:"split_type"`
+	SplitFormat string `yaml:"split_format"`
+	// SplitVia takes the period of each row from a parent table instead of
+	// split_column (split_type / split_format then describe the parent column)
+	SplitVia       *SplitVia `yaml:"split_via"`
+	ArchivePattern string    `yaml:"archive_pattern"`
+	// Granularity splits the table by year (default), quarter, month or
+	// day; archive_pattern may then use {quarter}, {month} and {day}
+	Granularity string `yaml:"granularity"`
+	// FiscalYearStart is the month (1-12) the table's years start in,
+	// overriding archive.fiscal_year_start. After LoadConfig it holds the
+	// effective month (1 = calendar years).
+	FiscalYearStart int `yaml:"fiscal_year_start"`
+	// Periods lists the periods to archive (e.g. "2024-01" or
+	// "2024-01..2024-06") instead of every period of archive.years
+	Periods []string `yaml:"periods"`
+	// Where narrows the rows archived (and deleted) beyond the split
+	// column, e.g. "status IN ('closed', 'cancelled')"
+	Where string `yaml:"where"`
+	// Retention resolves the periods at run time from a relative policy
+	// instead of archive.years / periods
+	Retention *Retention `yaml:"retention"`
+	// ArchiveDatabase overrides the archive server for this table. After
+	// LoadConfig it always holds the effective archive connection settings
+	// (table override, then top-level archive_database, then database).
+	ArchiveDatabase *Database `yaml:"archive_database"`
+	// Export overrides archive.options.export for this table. After
+	// LoadConfig it holds the effective export settings (nil = database).
+	Export *Export `yaml:"export"`
+	// Children are archived (and deleted) together with the table
+	Children Children `yaml:"children"`
+	// Group names a set of related tables processed together with one
+	// frozen cutoff and, where the engine supports it, one read snapshot
+	Group string `yaml:"group"`
+	// TimeZone is set by LoadConfig to database.time_zone, the zone the
+	// period boundaries of the table are computed in
+	TimeZone string `yaml:"-"`
+	// Parent is set on tables derived from Children: their rows are
+	// selected through the parent instead of a split column
+	Parent *ParentLink `yaml:"-"`
+}
+
+// Children lists the tables archived along with a table: explicit entries,
+// or "auto" to follow the foreign keys referencing it (recursively)
+type Children struct {
+	List []Child `yaml:"-"`
+	Auto bool
+}
+
+// UnmarshalYAML accepts a list of children or the scalar "auto"
+func (c *Children) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.SequenceNode:
+		*c = Children{}
+		return value.Decode(&c.List)
+	case yaml.ScalarNode:
+		if value.Value == "auto" {
+			*c = Children{Auto: true}
+			return nil
+		}
+		if value.Tag == "!!null" {
+			*c = Children{}
+			return nil
+		}
+	}
+	return fmt.Errorf("line %d: children must be a list of tables or \"auto\"", value.Line)
+}
+
+// Child is a table without a date of its own whose rows belong to the
+// parent rows they reference
+type Child struct {
+	Name      string   `yaml:"name"`
+	Key       string   `yaml:"key"`        // column of the child referencing the parent
+	ParentKey string   `yaml:"parent_key"` // referenced parent column (default: the parent's primary key)
+	Children  Children `yaml:"children"`
+}
+
+// SplitVia names the parent table whose date column decides the period of a
+// table without a date of its own
+type SplitVia struct {
+	Table     string `yaml:"table"`      // parent table, e.g. invoices
+	Key       string `yaml:"key"`        // column of this table referencing the parent, e.g. invoice_id
+	Column    string `yaml:"column"`     // date column of the parent, e.g. issued_at
+	ParentKey string `yaml:"parent_key"` // referenced parent column (default: the parent's primary key)
+}
+
+// ParentLink selects the rows of a table through its parent: the rows whose
+// Key matches ParentKey of a parent row in the period
+type ParentLink struct {
+	Parent    *Table
+	Key       string
+	ParentKey string
+}
+
+// Retention archives everything older than a relative cutoff. Exactly one
+// field is set; lengths are "<n><unit>" or "<n> <unit>" with unit d/day,
+// w/week, month, q/quarter or y/year.
+type Retention struct {
+	OlderThan string `yaml:"older_than"` // cutoff = now - length, e.g. 540d
+	KeepLast  string `yaml:"keep_last"`  // keep the current unit and the n-1 before it, e.g. 2 years
+}
+
+// Export configures archiving to flat files instead of a database. The
+// archive_pattern then resolves to the output directory.
+type Export struct {
+	Format         string `yaml:"format"`            // csv, ndjson or parquet
+	Compression    string `yaml:"compression"`       // gzip (default), zstd or none; parquet also snappy (its default)
+	MaxFileSizeMB  int    `yaml:"max_file_size_mb"`  // start a new part file after this many MB (default 256)
+	RowGroupSizeMB int    `yaml:"row_group_size_mb"` // parquet row group size (default 128)
+	// Upload optionally copies the sealed export to an S3-compatible bucket
+	Upload *Upload `yaml:"upload"`
+}
+
+// Upload configures uploading export files to S3-compatible object storage
+// (AWS S3, MinIO, ...)
+type Upload struct {
+	Endpoint   string `yaml:"endpoint"` // host[:port], e.g. s3.amazonaws.com or localhost:9000
+	Region     string `yaml:"region"`
+	Bucket     string `yaml:"bucket"`
+	AccessKey  string `yaml:"access_key"`
+	SecretKey  string `yaml:"secret_key"`
+	DisableTLS bool   `yaml:"disable_tls"` // plain HTTP, e.g. a local MinIO container
+	PathStyle  bool   `yaml:"path_style"`  // bucket in the path instead of the host name
+	// KeyPattern builds object keys from {table}, the period placeholders
+	// ({year}, {quarter}, {month}, {day}) and {file}
+	// (default: archive_pattern + "/{file}")
+	KeyPattern string `yaml:"key_pattern"`
+	PartSizeMB int    `yaml:"part_size_mb"` // multipart part size (default 64, minimum 5)
+	MaxRetries int    `yaml:"max_retries"`  // attempts per file (default 3)
 }
 
 // Archive holds archive-related settings
 type Archive struct {
-	Years   []int          `yaml:"years"`
-	Options ArchiveOptions `yaml:"options"`
+	Years Years `yaml:"years"`
+	// FiscalYearStart is the month (1-12) years start in, e.g. 4 for
+	// April-March fiscal years (default 1, calendar years)
+	FiscalYearStart int            `yaml:"fiscal_year_start"`
+	Options         ArchiveOptions `yaml:"options"`
+}
+
+// Years is archive.years: either a list of years, or "auto" to archive the
+// years found in each table's split_column. The long form of auto bounds
+// the discovered years:
+//
+//	years:
+//	  auto: true
+//	  min: 2020
+//	  max: 2024
+//	  exclude_current: true
+type Years struct {
+	List []int `yaml:"-"`
+	Auto bool  `yaml:"auto"`
+	Min  int   `yaml:"min"` // skip discovered years before min (0 = no bound)
+	Max  int   `yaml:"max"` // skip discovered years after max (0 = no bound)
+	// ExcludeCurrent skips the current year and any later year, which are
+	// still receiving rows
+	ExcludeCurrent bool `yaml:"exclude_current"`
+}
+
+// UnmarshalYAML accepts a list of years, the scalar "auto" or the auto
+// mapping
+func (y *Years) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.SequenceNode:
+		*y = Years{}
+		return value.Decode(&y.List)
+	case yaml.ScalarNode:
+		if value.Value == "auto" {
+			*y = Years{Auto: true}
+			return nil
+		}
+		if value.Tag == "!!null" {
+			*y = Years{}
+			return nil
+		}
+	case yaml.MappingNode:
+		type plain Years
+		var decoded plain
+		if err := value.Decode(&decoded); err != nil {
+			return err
+		}
+		*y = Years(decoded)
+		return nil
+	}
+	return fmt.Errorf("line %d: archive.years must be a list of years or \"auto\"", value.Line)
+}
+
+// Resume is the position a failed table/period migration continues from
+type Resume struct {
+	Table  string   `yaml:"table"`
+	Period string   `yaml:"period"` // period label, e.g. 2024, 2024-Q1 or 2024-03
+	Key    []string `yaml:"key"`    // one value per primary key column
 }
 
 // ArchiveOptions holds archive processing options
 type ArchiveOptions struct {
-	BatchSize          int  `yaml:"batch_size"`
+	BatchSize int `yaml:"batch_size"`
+	// Resume continues one table/period after a primary key (as printed
+	// when a batch fails); every other table/period starts from the beginning
+	Resume *Resume `yaml:"resume"`
+	// ResumeKey is no longer supported: it applied to every table and
+	// period of the run. Use Resume.
+	ResumeKey []string `yaml:"resume_key"`
+	// ResumeOffset is no longer supported: batches are paged by primary key,
+	// so row offsets are not stable. Use Resume.
 	ResumeOffset       int  `yaml:"resume_offset"`
 	DeleteAfterArchive bool `yaml:"delete_after_archive"`
 	CreateArchiveDB    bool `yaml:"create_archive_db"`
@@ -44,6 +256,20 @@ type ArchiveOptions struct {
 	// This value is supplied from the top-level processing config when the
 	// migration is started.
 	HeartbeatBatchInterval int `yaml:"heartbeat_batch_interval"`
+	// MappingReportDir is where cross-engine type mapping reports are
+	// written (default: logs)
+	MappingReportDir string `yaml:"mapping_report_dir"`
+	// Export archives every table to files unless the table overrides it
+	Export *Export `yaml:"export"`
+	// GracePeriod is how long after its end a period counts as closed and
+	// may be archived, e.g. "30d" (default: as soon as it ends)
+	GracePeriod string `yaml:"grace_period"`
+	// AllowOpenPeriod archives periods that have not closed yet; set by the
+	// --allow-open-period flag, never from the config file
+	AllowOpenPeriod bool `yaml:"-"`
+	// ScriptDir switches to review mode: the SQL of every table/year is
+	// written to files in this directory instead of being executed
+	ScriptDir string `yaml:"script_dir"`
 }
 
 // Processing holds processing configuration